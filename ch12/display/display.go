@@ -8,15 +8,18 @@ package display
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 //!+Display
 
 func Display(name string, x interface{}) {
-	fmt.Printf("Display %s (%T):\n", name, x)
-	display(name, reflect.ValueOf(x))
+	Options{}.Display(name, x)
 }
 
 //!-Display
@@ -50,41 +53,315 @@ func formatAtom(v reflect.Value) string {
 	}
 }
 
+// Options controls how Display shows a value.
+type Options struct {
+	Out      io.Writer // destination; nil means os.Stdout
+	MaxDepth int       // if positive, expand only values fewer than MaxDepth selectors deep
+	MaxLen   int       // if positive, show at most MaxLen elements of each array, slice, or map
+
+	// Filter, if non-empty, restricts the display to values whose
+	// paths, relative to x, match one of its patterns, and their
+	// components.  A pattern is a sequence of selectors such as
+	// .Actor["Dr. Strangelove"] or .Oscars[0]; the wildcards .* and
+	// [*] match any field and any index or key.  Pointers and
+	// interfaces are not part of a path, so .Tail.Value matches
+	// the path (*x.Tail).Value.
+	Filter []string
+}
+
+// Display prints the components of x, much like the function of
+// the same name, but according to the options.  It shows the
+// entries of a map in the order of their formatted keys.
+//
+// Display is safe for cyclic values.  A pointer, map, or slice that
+// refers back to a value being displayed is shown as #n#, where the
+// value was labeled #n= on the first line of its display, and lines
+// within it begin #n#.  For example:
+//
+//	c.Value = 42
+//	#1=(*c.Tail).Value = 42
+//	(*#1#.Tail) = #1#
+func (o Options) Display(name string, x interface{}) {
+	d := &displayer{opts: o, out: o.Out}
+	if d.out == nil {
+		d.out = os.Stdout
+	}
+	for _, pattern := range o.Filter {
+		d.filter = append(d.filter, splitPath(pattern))
+	}
+	fmt.Fprintf(d.out, "Display %s (%T):\n", name, x)
+
+	// The first pass finds the values that close cycles;
+	// the second labels them and prints.
+	v := reflect.ValueOf(x)
+	d.cycles = make(map[ref]bool)
+	d.active = make(map[ref]int)
+	d.keys = make(map[ref][]reflect.Value)
+	d.dry = true
+	d.display(name, v, nil)
+	d.dry = false
+	d.display(name, v, nil)
+}
+
+// A displayer holds the state of a call to Options.Display.
+type displayer struct {
+	opts   Options
+	out    io.Writer
+	filter [][]string // split Filter patterns
+	dry    bool       // first pass: find cycles but print nothing
+
+	cycles  map[ref]bool            // values referred to from within themselves
+	active  map[ref]int             // values being displayed, and their labels (or 0)
+	keys    map[ref][]reflect.Value // the sorted keys of each map, the same in both passes
+	labels  int                     // number of labels assigned
+	pending []string                // pending[n-1] is the #n= definition of label n, until printed
+}
+
+// A ref identifies a value that may be referred to more than once:
+// the target of a pointer, a map, or the elements of a slice.
+type ref struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
 //!+display
-func display(path string, v reflect.Value) {
+// display prints the value v, found at the specified path, whose
+// selectors (fields, indices, and keys) are elems.
+func (d *displayer) display(path string, v reflect.Value, elems []string) {
+	selected, ok := d.match(elems)
+	if !ok {
+		return
+	}
+	if d.opts.MaxDepth > 0 && len(elems) >= d.opts.MaxDepth && !isAtom(v) {
+		if selected {
+			d.printf(path, "...")
+		}
+		return
+	}
 	switch v.Kind() {
 	case reflect.Invalid:
-		fmt.Printf("%s = invalid\n", path)
+		if selected {
+			d.printf(path, "invalid")
+		}
 	case reflect.Slice, reflect.Array:
-		for i := 0; i < v.Len(); i++ {
-			display(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+		if v.Kind() == reflect.Slice {
+			if v.Len() == 0 {
+				break
+			}
+			var done func()
+			if path, done = d.enter(path, path, v, ref{v.Pointer(), v.Type(), v.Len()}); done == nil {
+				break
+			}
+			defer done()
+		}
+		n := v.Len()
+		if d.opts.MaxLen > 0 && n > d.opts.MaxLen {
+			n = d.opts.MaxLen
+			if selected {
+				defer d.printf(path+"[...]", "(%d more)", v.Len()-n)
+			}
+		}
+		for i := 0; i < n; i++ {
+			elem := fmt.Sprintf("[%d]", i)
+			d.display(path+elem, v.Index(i), append(elems, elem))
 		}
 	case reflect.Struct:
 		for i := 0; i < v.NumField(); i++ {
-			fieldPath := fmt.Sprintf("%s.%s", path, v.Type().Field(i).Name)
-			display(fieldPath, v.Field(i))
+			elem := "." + v.Type().Field(i).Name
+			d.display(path+elem, v.Field(i), append(elems, elem))
 		}
 	case reflect.Map:
-		for _, key := range v.MapKeys() {
-			display(fmt.Sprintf("%s[%s]", path,
-				formatAtom(key)), v.MapIndex(key))
+		if v.IsNil() {
+			break
+		}
+		var done func()
+		if path, done = d.enter(path, path, v, ref{v.Pointer(), v.Type(), 0}); done == nil {
+			break
+		}
+		defer done()
+		for i, key := range d.mapKeys(v) {
+			if d.opts.MaxLen > 0 && i == d.opts.MaxLen {
+				if selected {
+					d.printf(path+"[...]", "(%d more)", v.Len()-i)
+				}
+				break
+			}
+			elem := fmt.Sprintf("[%s]", formatAtom(key))
+			d.display(path+elem, v.MapIndex(key), append(elems, elem))
 		}
 	case reflect.Ptr:
 		if v.IsNil() {
-			fmt.Printf("%s = nil\n", path)
-		} else {
-			display(fmt.Sprintf("(*%s)", path), v.Elem())
+			if selected {
+				d.printf(path, "nil")
+			}
+			break
+		}
+		path, done := d.enter(path, fmt.Sprintf("(*%s)", path), v, ref{v.Pointer(), v.Type(), 0})
+		if done != nil {
+			d.display(path, v.Elem(), elems)
+			done()
 		}
 	case reflect.Interface:
 		if v.IsNil() {
-			fmt.Printf("%s = nil\n", path)
+			if selected {
+				d.printf(path, "nil")
+			}
 		} else {
-			fmt.Printf("%s.type = %s\n", path, v.Elem().Type())
-			display(path+".value", v.Elem())
+			if selected {
+				d.printf(path+".type", "%s", v.Elem().Type())
+			}
+			d.display(path+".value", v.Elem(), elems)
 		}
 	default: // basic types, channels, funcs
-		fmt.Printf("%s = %s\n", path, formatAtom(v))
+		if selected {
+			d.printf(path, "%s", formatAtom(v))
+		}
 	}
 }
 
 //!-display
+
+// enter marks the start of the display of the value r, which v
+// refers to from path.  objPath is the path of the value itself.
+// If the value is already being displayed, enter prints a
+// back-reference and returns a nil done function; otherwise it
+// returns the path by which to display the value, and a function
+// to call when its display is done.
+func (d *displayer) enter(path, objPath string, v reflect.Value, r ref) (string, func()) {
+	if d.dry {
+		if _, ok := d.active[r]; ok {
+			d.cycles[r] = true
+			return "", nil
+		}
+	} else if label, ok := d.active[r]; ok {
+		if label == 0 {
+			// Unreachable while both passes visit the same
+			// values, but an undefined #0# would be worse.
+			d.printf(objPath, "%s", formatAtom(v))
+		} else {
+			d.printf(objPath, "#%d#", label)
+		}
+		return "", nil
+	}
+	label := 0
+	if !d.dry && d.cycles[r] {
+		d.labels++
+		label = d.labels
+		d.pending = append(d.pending, fmt.Sprintf("#%d=%s", label, objPath))
+		objPath = fmt.Sprintf("#%d#", label)
+	}
+	d.active[r] = label
+	return objPath, func() { delete(d.active, r) }
+}
+
+// mapKeys returns the keys of the map v, sorted by their display.
+// Both passes visit the keys in the same order, so that the second
+// encounters the same cycles as the first, even with MaxLen.
+func (d *displayer) mapKeys(v reflect.Value) []reflect.Value {
+	r := ref{v.Pointer(), v.Type(), 0}
+	keys, ok := d.keys[r]
+	if !ok {
+		keys = v.MapKeys()
+		sort.SliceStable(keys, func(i, j int) bool {
+			return formatAtom(keys[i]) < formatAtom(keys[j])
+		})
+		d.keys[r] = keys
+	}
+	return keys
+}
+
+// printf prints a line showing the value at path, defining
+// any labels that the path uses for the first time.
+func (d *displayer) printf(path, format string, args ...interface{}) {
+	if d.dry {
+		return
+	}
+	// Replace later labels first, as their definitions
+	// may contain earlier ones.
+	for n := len(d.pending); n > 0; n-- {
+		def := d.pending[n-1]
+		if label := fmt.Sprintf("#%d#", n); def != "" && strings.Contains(path, label) {
+			path = strings.Replace(path, label, def, 1)
+			d.pending[n-1] = ""
+		}
+	}
+	fmt.Fprintf(d.out, "%s = %s\n", path, fmt.Sprintf(format, args...))
+}
+
+// match reports whether the path whose selectors are elems matches
+// a filter pattern (selected), or is a prefix of one (ok only).
+func (d *displayer) match(elems []string) (selected, ok bool) {
+	if len(d.filter) == 0 {
+		return true, true
+	}
+	for _, pattern := range d.filter {
+		n := len(elems)
+		if len(pattern) < n {
+			n = len(pattern)
+		}
+		i := 0
+		for i < n && matchElem(pattern[i], elems[i]) {
+			i++
+		}
+		if i == n {
+			if len(elems) >= len(pattern) {
+				return true, true
+			}
+			ok = true
+		}
+	}
+	return false, ok
+}
+
+func matchElem(pattern, elem string) bool {
+	switch pattern {
+	case ".*":
+		return strings.HasPrefix(elem, ".")
+	case "[*]":
+		return strings.HasPrefix(elem, "[")
+	}
+	return pattern == elem
+}
+
+// splitPath splits a path such as .Actor["Dr. Strangelove"][*]
+// into its selectors.
+func splitPath(path string) []string {
+	var elems []string
+	for i := 0; i < len(path); {
+		j := i + 1
+		if path[i] == '[' {
+			// Find the closing bracket, skipping quoted keys.
+			for j < len(path) && path[j] != ']' {
+				if path[j] == '"' {
+					if q, err := strconv.QuotedPrefix(path[j:]); err == nil {
+						j += len(q)
+						continue
+					}
+				}
+				j++
+			}
+			if j < len(path) {
+				j++ // ']'
+			}
+		} else {
+			for j < len(path) && path[j] != '.' && path[j] != '[' {
+				j++
+			}
+		}
+		elems = append(elems, path[i:j])
+		i = j
+	}
+	return elems
+}
+
+// isAtom reports whether v is displayed on a single line.
+func isAtom(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Struct:
+		return false
+	case reflect.Slice, reflect.Map, reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return true
+}
@@ -4,6 +4,7 @@
 package display
 
 import (
+	"bytes"
 	"io"
 	"net"
 	"os"
@@ -26,11 +27,12 @@ func Example_expr() {
 	// Display e (eval.call):
 	// e.fn = "sqrt"
 	// e.args[0].type = eval.binary
-	// e.args[0].value.op = 47
+	// e.args[0].value.op = "/"
 	// e.args[0].value.x.type = eval.Var
 	// e.args[0].value.x.value = "A"
 	// e.args[0].value.y.type = eval.Var
 	// e.args[0].value.y.value = "pi"
+	// e.f = nil
 }
 
 func Example_slice() {
@@ -211,34 +213,28 @@ func Test(t *testing.T) {
 	type P *P
 	var p P
 	p = &p
-	if false {
-		Display("p", p)
-		// Output:
-		// Display p (display.P):
-		// ...stuck, no output...
-	}
+	Display("p", p)
+	// Output:
+	// Display p (display.P):
+	// (*#1=(*p)) = #1#
 
 	// a map that contains itself
 	type M map[string]M
 	m := make(M)
 	m[""] = m
-	if false {
-		Display("m", m)
-		// Output:
-		// Display m (display.M):
-		// ...stuck, no output...
-	}
+	Display("m", m)
+	// Output:
+	// Display m (display.M):
+	// #1=m[""] = #1#
 
 	// a slice that contains itself
 	type S []S
 	s := make(S, 1)
 	s[0] = s
-	if false {
-		Display("s", s)
-		// Output:
-		// Display s (display.S):
-		// ...stuck, no output...
-	}
+	Display("s", s)
+	// Output:
+	// Display s (display.S):
+	// #1=s[0] = #1#
 
 	// a linked list that eats its own tail
 	type Cycle struct {
@@ -247,13 +243,137 @@ func Test(t *testing.T) {
 	}
 	var c Cycle
 	c = Cycle{42, &c}
-	if false {
-		Display("c", c)
-		// Output:
-		// Display c (display.Cycle):
-		// c.Value = 42
-		// (*c.Tail).Value = 42
-		// (*(*c.Tail).Tail).Value = 42
-		// ...ad infinitum...
+	Display("c", c)
+	// Output:
+	// Display c (display.Cycle):
+	// c.Value = 42
+	// #1=(*c.Tail).Value = 42
+	// (*#1#.Tail) = #1#
+}
+
+func Example_cycle() {
+	type Node struct {
+		Value int
+		Next  *Node
+	}
+	a := &Node{Value: 1}
+	b := &Node{2, a}
+	a.Next = b
+	Display("a", a)
+
+	// A value shared without a cycle is displayed twice.
+	c := &Node{Value: 3}
+	Display("pair", [2]*Node{c, c})
+	// Output:
+	// Display a (*display.Node):
+	// #1=(*a).Value = 1
+	// (*#1#.Next).Value = 2
+	// (*(*#1#.Next).Next) = #1#
+	// Display pair ([2]*display.Node):
+	// (*pair[0]).Value = 3
+	// (*pair[0]).Next = nil
+	// (*pair[1]).Value = 3
+	// (*pair[1]).Next = nil
+}
+
+type movie struct {
+	Title  string
+	Year   int
+	Actor  map[string]string
+	Oscars []string
+	Sequel *movie
+}
+
+var strangelove = movie{
+	Title: "Dr. Strangelove",
+	Year:  1964,
+	Actor: map[string]string{
+		"Dr. Strangelove":     "Peter Sellers",
+		"Gen. Buck Turgidson": "George C. Scott",
+	},
+	Oscars: []string{
+		"Best Actor (Nomin.)",
+		"Best Adapted Screenplay (Nomin.)",
+		"Best Director (Nomin.)",
+		"Best Picture (Nomin.)",
+	},
+}
+
+func ExampleOptions_maxLen() {
+	Options{MaxLen: 2}.Display("oscars", strangelove.Oscars)
+	// Output:
+	// Display oscars ([]string):
+	// oscars[0] = "Best Actor (Nomin.)"
+	// oscars[1] = "Best Adapted Screenplay (Nomin.)"
+	// oscars[...] = (2 more)
+}
+
+func ExampleOptions_maxDepth() {
+	m := strangelove
+	m.Sequel = &movie{Title: "Son of Strangelove"}
+	Options{MaxDepth: 1}.Display("m", m)
+	// Output:
+	// Display m (display.movie):
+	// m.Title = "Dr. Strangelove"
+	// m.Year = 1964
+	// m.Actor = ...
+	// m.Oscars = ...
+	// m.Sequel = ...
+}
+
+func ExampleOptions_filter() {
+	m := strangelove
+	m.Sequel = &movie{Title: "Son of Strangelove", Oscars: []string{"None"}}
+	Options{
+		Filter: []string{`.Actor["Dr. Strangelove"]`, ".Sequel.*[0]"},
+	}.Display("m", m)
+	// Output:
+	// Display m (display.movie):
+	// m.Actor["Dr. Strangelove"] = "Peter Sellers"
+	// (*m.Sequel).Oscars[0] = "None"
+}
+
+func TestOptionsOut(t *testing.T) {
+	var buf bytes.Buffer
+	Options{Out: &buf, Filter: []string{".Year"}}.Display("m", strangelove)
+	const want = "Display m (display.movie):\nm.Year = 1964\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Display wrote %q, want %q", got, want)
+	}
+}
+
+// TestMapCycleMaxLen checks that a cycle within the shown elements
+// of a map is labeled, whatever order the map's keys come in.
+func TestMapCycleMaxLen(t *testing.T) {
+	type node struct{ Next *node }
+	cyclic := &node{}
+	cyclic.Next = cyclic
+	m := map[string]*node{"a": cyclic, "b": {}, "c": {}, "d": {}}
+	const want = `Display m (map[string]*display.node):
+(*#1=(*m["a"]).Next) = #1#
+m[...] = (3 more)
+`
+	for i := 0; i < 100; i++ {
+		var buf bytes.Buffer
+		Options{Out: &buf, MaxLen: 1}.Display("m", m)
+		if got := buf.String(); got != want {
+			t.Fatalf("Display wrote %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		want []string
+	}{
+		{"", nil},
+		{".Actor[*]", []string{".Actor", "[*]"}},
+		{`.Actor["a].[b"].Name`, []string{".Actor", `["a].[b"]`, ".Name"}},
+		{".x[1][2", []string{".x", "[1]", "[2"}},
+	} {
+		if got := splitPath(test.path); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitPath(%q) = %q, want %q", test.path, got, test.want)
+		}
 	}
 }
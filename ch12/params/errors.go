@@ -0,0 +1,48 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package params
+
+import (
+	"fmt"
+	"sort"
+)
+
+// An Error is a problem with one request parameter.
+type Error struct {
+	Name  string // the parameter, such as addr.city
+	Value string // the offending value, if any
+	Err   error
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%s: %v", e.Name, e.Err) }
+
+// An ErrorList is a list of errors, ordered by parameter name.
+// Unpack reports all the problems it finds as an ErrorList.
+type ErrorList []*Error
+
+// add appends an error about the named parameter to the list.
+func (l *ErrorList) add(name, value string, err error) {
+	*l = append(*l, &Error{name, value, err})
+}
+
+// Err returns an error equivalent to the list, sorted by name,
+// or nil if the list is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	sort.SliceStable(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	return l
+}
+
+// Error returns the message of the first error, and the number of others.
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
@@ -0,0 +1,89 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package params
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Pack returns the URL parameters that represent the fields of the
+// struct pointed to by ptr, named as for Unpack, so that Unpack
+// recovers the fields from a request with those parameters.
+// Each element of a slice is a separate value of its parameter.
+//
+// Pack does not check the values against the constraints of their
+// tags.
+func Pack(ptr interface{}) (url.Values, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr {
+		// Copy a struct, so that its fields are addressable
+		// and may have methods with pointer receivers.
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		v = p
+	}
+	fields := make(map[string]*field)
+	if err := addFields(fields, "", v.Elem()); err != nil {
+		return nil, err
+	}
+	params := make(url.Values)
+	for name, f := range fields {
+		if f.v.Kind() == reflect.Slice && !isText(f.v.Type()) {
+			for i := 0; i < f.v.Len(); i++ {
+				s, err := format(f.v.Index(i))
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", name, err)
+				}
+				params.Add(name, s)
+			}
+			continue
+		}
+		s, err := format(f.v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		params.Set(name, s)
+	}
+	return params, nil
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// format is the inverse of populate.  Like populate, it uses the
+// methods of a pointer to v, if v is addressable.
+func format(v reflect.Value) (string, error) {
+	if v.CanAddr() && v.Addr().Type().Implements(textMarshalerType) {
+		v = v.Addr()
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	}
+	return "", fmt.Errorf("unsupported kind %s", v.Type())
+}
@@ -0,0 +1,146 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package params
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"gopl.io/ch13/equal"
+)
+
+type place struct {
+	City string `http:"city"`
+	Zip  string
+}
+
+type record struct {
+	Labels  []string `http:"l"`
+	Counts  []int8
+	N       int64
+	Exact   bool `http:"x"`
+	Ratio   float64
+	Small   float32
+	Port    uint16
+	Where   place
+	Timeout time.Duration
+	When    time.Time
+}
+
+// Generate implements quick.Generator.  Times are in UTC, and
+// between years 0 and 9999 so that they have a text form.
+func (record) Generate(rand *rand.Rand, size int) reflect.Value {
+	var r record
+	v := reflect.ValueOf(&r).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		switch f := v.Field(i); f.Interface().(type) {
+		case place, time.Time:
+			// see below
+		default:
+			x, _ := quick.Value(f.Type(), rand)
+			f.Set(x)
+		}
+	}
+	r.Where.City, r.Where.Zip = randString(rand), randString(rand)
+	r.When = time.Unix(rand.Int63n(253402300800)-62135596800, rand.Int63n(1e9)).UTC()
+	return reflect.ValueOf(r)
+}
+
+func randString(rand *rand.Rand) string {
+	s, _ := quick.Value(reflect.TypeOf(""), rand)
+	return s.String()
+}
+
+// TestPackUnpack checks that Unpack recovers the value from the
+// parameters made by Pack.
+func TestPackUnpack(t *testing.T) {
+	roundTrip := func(r record) bool {
+		params, err := Pack(&r)
+		if err != nil {
+			t.Errorf("Pack(%+v): %v", r, err)
+			return false
+		}
+		req := httptest.NewRequest("GET", "http://localhost/?"+params.Encode(), nil)
+		var got record
+		if err := Unpack(req, &got); err != nil {
+			t.Errorf("Unpack(%s): %v", params.Encode(), err)
+			return false
+		}
+		if !equal.Equal(got, r) {
+			t.Errorf("Pack then Unpack of %+v yielded %+v; differences: %v", r, got, equal.Diff(r, got))
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// A point has text methods with pointer receivers.
+type point struct{ X, Y int }
+
+func (p *point) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d,%d", p.X, p.Y)), nil
+}
+
+func (p *point) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "%d,%d", &p.X, &p.Y)
+	return err
+}
+
+func TestPackPointerMethods(t *testing.T) {
+	type path struct {
+		Start point
+		Via   []point
+	}
+	p := path{point{1, 2}, []point{{3, 4}, {5, 6}}}
+	const want = "start=1%2C2&via=3%2C4&via=5%2C6"
+	for _, x := range []interface{}{&p, p} {
+		params, err := Pack(x)
+		if err != nil {
+			t.Fatalf("Pack(%T): %v", x, err)
+		}
+		if got := params.Encode(); got != want {
+			t.Errorf("Pack(%T) = %s, want %s", x, got, want)
+		}
+		req := httptest.NewRequest("GET", "http://localhost/?"+params.Encode(), nil)
+		var got path
+		if err := Unpack(req, &got); err != nil {
+			t.Fatalf("Unpack(%s): %v", params.Encode(), err)
+		}
+		if !equal.Equal(got, p) {
+			t.Errorf("Pack then Unpack of %+v yielded %+v", p, got)
+		}
+	}
+}
+
+func TestPack(t *testing.T) {
+	q := query{
+		Labels:     []string{"golang", "programming"},
+		MaxResults: 10,
+		Timeout:    90 * time.Second,
+		Addr:       address{City: "New York"},
+		Secret:     "x",
+	}
+	params, err := Pack(q) // a struct is allowed too
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "addr.city=New+York&addr.zip=&l=golang&l=programming&max=10&port=0&r=0" +
+		"&since=0001-01-01T00%3A00%3A00Z&timeout=1m30s&x=false"
+	if got := params.Encode(); got != want {
+		t.Errorf("Pack = %s, want %s", got, want)
+	}
+
+	if _, err := Pack(&struct{ M map[string]int }{}); err == nil ||
+		err.Error() != "m: unsupported kind map[string]int" {
+		t.Errorf("Pack of map field returned %v", err)
+	}
+}
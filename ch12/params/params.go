@@ -7,73 +7,168 @@
 package params
 
 import (
+	"encoding"
 	"fmt"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 //!+Unpack
 
 // Unpack populates the fields of the struct pointed to by ptr
 // from the HTTP request parameters in req.
+//
+// A field's parameter is named by its http tag, or else by its name
+// in lower case.  The fields of a nested struct are named with the
+// prefix of the struct's parameter and a dot, as in addr.city.
+// Options that follow the name in the tag constrain the values:
+//
+//	Max   int    `http:"max,required,min=1,max=100"`
+//	Zip   string `http:"zip,pattern=[0-9]{5}(-[0-9]{4})?"`
+//	Delay time.Duration `http:"delay,max=1m"`
+//
+// required means the parameter must be present; min and max limit
+// a number or duration, or the length of a string; and pattern is a
+// regular expression that the whole of each value must match.
+// Because the pattern may contain commas, it must come last.
+//
+// Unpack reports all the parameters that are unknown, missing,
+// malformed, or out of range as an ErrorList.
 func Unpack(req *http.Request, ptr interface{}) error {
 	if err := req.ParseForm(); err != nil {
 		return err
 	}
 
 	// Build map of fields keyed by effective name.
-	fields := make(map[string]reflect.Value)
-	v := reflect.ValueOf(ptr).Elem() // the struct variable
-	for i := 0; i < v.NumField(); i++ {
-		fieldInfo := v.Type().Field(i) // a reflect.StructField
-		tag := fieldInfo.Tag           // a reflect.StructTag
-		name := tag.Get("http")
-		if name == "" {
-			name = strings.ToLower(fieldInfo.Name)
-		}
-		fields[name] = v.Field(i)
+	fields := make(map[string]*field)
+	if err := addFields(fields, "", reflect.ValueOf(ptr).Elem()); err != nil {
+		return err
 	}
 
 	// Update struct field for each parameter in the request.
+	var errs ErrorList
 	for name, values := range req.Form {
 		f := fields[name]
-		if !f.IsValid() {
-			continue // ignore unrecognized HTTP parameters
+		if f == nil {
+			errs.add(name, "", fmt.Errorf("unknown parameter"))
+			continue
 		}
 		for _, value := range values {
-			if f.Kind() == reflect.Slice {
-				elem := reflect.New(f.Type().Elem()).Elem()
-				if err := populate(elem, value); err != nil {
-					return fmt.Errorf("%s: %v", name, err)
-				}
-				f.Set(reflect.Append(f, elem))
-			} else {
-				if err := populate(f, value); err != nil {
-					return fmt.Errorf("%s: %v", name, err)
-				}
+			v := f.v
+			if v.Kind() == reflect.Slice && !isText(v.Type()) {
+				v = reflect.New(v.Type().Elem()).Elem()
+			}
+			if err := populate(v, value); err != nil {
+				errs.add(name, value, err)
+				continue
+			}
+			if err := f.check(v, value); err != nil {
+				errs.add(name, value, err)
+				continue
+			}
+			if v != f.v {
+				f.v.Set(reflect.Append(f.v, v))
 			}
 		}
 	}
-	return nil
+	for name, f := range fields {
+		if _, ok := req.Form[name]; f.required && !ok {
+			errs.add(name, "", fmt.Errorf("missing required parameter"))
+		}
+	}
+	return errs.Err()
 }
 
 //!-Unpack
 
+// addFields adds to fields the parameter fields of struct v,
+// whose parameter names begin with prefix.
+func addFields(fields map[string]*field, prefix string, v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		fieldInfo := v.Type().Field(i) // a reflect.StructField
+		if fieldInfo.PkgPath != "" {
+			continue // unexported
+		}
+		tag := fieldInfo.Tag.Get("http")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		if name == "" {
+			name = strings.ToLower(fieldInfo.Name)
+		}
+		name = prefix + name
+		f := &field{v: v.Field(i)}
+		if f.v.Kind() == reflect.Struct && !isText(f.v.Type()) {
+			if opts != "" {
+				return fmt.Errorf("%s: options not allowed on struct field", name)
+			}
+			if err := addFields(fields, name+".", f.v); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := parseTag(f, opts); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		fields[name] = f
+	}
+	return nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isText reports whether values of type t parse themselves
+// with an UnmarshalText method.
+func isText(t reflect.Type) bool {
+	return reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
 //!+populate
 func populate(v reflect.Value, value string) error {
+	if isText(v.Type()) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
 	switch v.Kind() {
 	case reflect.String:
 		v.SetString(value)
 
-	case reflect.Int:
-		i, err := strconv.ParseInt(value, 10, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
 		if err != nil {
 			return err
 		}
 		v.SetInt(i)
 
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
 	case reflect.Bool:
 		b, err := strconv.ParseBool(value)
 		if err != nil {
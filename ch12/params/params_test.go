@@ -0,0 +1,121 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package params
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type address struct {
+	City string `http:"city,required"`
+	Zip  string `http:"zip,pattern=[0-9]{5}(-[0-9]{4})?"`
+}
+
+type query struct {
+	Labels     []string      `http:"l,max=12"`
+	MaxResults int           `http:"max,min=1,max=100"`
+	Exact      bool          `http:"x"`
+	Ratio      float64       `http:"r,min=0,max=1"`
+	Timeout    time.Duration `http:"timeout,max=1m"`
+	Since      time.Time     `http:"since"`
+	Port       uint16        `http:"port"`
+	Addr       address       `http:"addr"`
+	IPs        []net.IP      `http:"ip"`
+	Secret     string        `http:"-"`
+}
+
+func unpack(url string) (query, error) {
+	req := httptest.NewRequest("GET", "http://localhost/search?"+url, nil)
+	q := query{MaxResults: 10}
+	err := Unpack(req, &q)
+	return q, err
+}
+
+func TestUnpack(t *testing.T) {
+	q, err := unpack("l=golang&l=programming&max=100&x=true&r=0.5&timeout=30s" +
+		"&since=2016-01-02T15:04:05Z&port=8080&addr.city=New+York&addr.zip=10001-1234" +
+		"&ip=127.0.0.1&ip=::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := query{
+		Labels:     []string{"golang", "programming"},
+		MaxResults: 100,
+		Exact:      true,
+		Ratio:      0.5,
+		Timeout:    30 * time.Second,
+		Since:      time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC),
+		Port:       8080,
+		Addr:       address{"New York", "10001-1234"},
+		IPs:        []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("Unpack =\n%+v, want\n%+v", q, want)
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	_, err := unpack("max=0&l=a&l=abcdefghijklmnop&r=lots&timeout=1h&port=70000" +
+		"&addr.zip=1234&since=yesterday&ip=localhost&secret=x&q=hello")
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Unpack returned %v, want ErrorList", err)
+	}
+	var got []string
+	for _, e := range list {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		`addr.city: missing required parameter`,
+		`addr.zip: "1234" does not match [0-9]{5}(-[0-9]{4})?`,
+		`ip: invalid IP address: localhost`,
+		`l: length must be at most 12`,
+		`max: value must be at least 1`,
+		`port: strconv.ParseUint: parsing "70000": value out of range`,
+		`q: unknown parameter`,
+		`r: strconv.ParseFloat: parsing "lots": invalid syntax`,
+		`secret: unknown parameter`,
+		`since: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`,
+		`timeout: value must be at most 1m`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unpack errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if e := list[3]; e.Name != "l" || e.Value != "abcdefghijklmnop" {
+		t.Errorf("list[3] = %+v, want l=abcdefghijklmnop", e)
+	}
+	if want := fmt.Sprintf("%s (and 10 more errors)", want[0]); err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+}
+
+func TestUnpackBadTag(t *testing.T) {
+	for _, ptr := range []interface{}{
+		&struct {
+			X bool `http:"x,min=1"`
+		}{},
+		&struct {
+			X int `http:"x,between=1"`
+		}{},
+		&struct {
+			X string `http:"x,pattern=("`
+		}{},
+		&struct {
+			X time.Duration `http:"x,max=1"`
+		}{},
+	} {
+		req := httptest.NewRequest("GET", "http://localhost/", nil)
+		if err := Unpack(req, ptr); err == nil {
+			t.Errorf("Unpack(%T) succeeded, want error", ptr)
+		} else if _, ok := err.(ErrorList); ok {
+			t.Errorf("Unpack(%T) = %v, want error other than ErrorList", ptr, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package params
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A field is a struct field that holds a request parameter,
+// with the constraints on its values given by its http tag.
+type field struct {
+	v        reflect.Value
+	required bool           // the parameter must be present
+	min, max *bound         // limits of each value, if any
+	pattern  *regexp.Regexp // each value must match, if non-nil
+	patText  string         // pattern as written in the tag
+}
+
+// A bound is a limit on a number or duration, or on the length of a string.
+type bound struct {
+	text string // as written in the tag
+	x    float64
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// parseTag parses the options that follow the name in the http tag
+// of field f.
+func parseTag(f *field, opts string) error {
+	for opts != "" {
+		var opt string
+		if strings.HasPrefix(opts, "pattern=") {
+			opt, opts = opts, "" // the pattern may contain commas
+		} else if i := strings.Index(opts, ","); i >= 0 {
+			opt, opts = opts[:i], opts[i+1:]
+		} else {
+			opt, opts = opts, ""
+		}
+		key, value := opt, ""
+		if i := strings.Index(opt, "="); i >= 0 {
+			key, value = opt[:i], opt[i+1:]
+		}
+		switch key {
+		case "required":
+			f.required = true
+		case "min", "max":
+			b, err := parseBound(f.v.Type(), value)
+			if err != nil {
+				return fmt.Errorf("bad %s: %v", opt, err)
+			}
+			if key == "min" {
+				f.min = b
+			} else {
+				f.max = b
+			}
+		case "pattern":
+			re, err := regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return err
+			}
+			f.pattern, f.patText = re, value
+		default:
+			return fmt.Errorf("unknown option %q", opt)
+		}
+	}
+	return nil
+}
+
+// parseBound parses a min or max option for a field of type t.
+func parseBound(t reflect.Type, text string) (*bound, error) {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t == durationType {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, err
+		}
+		return &bound{text, float64(d)}, nil
+	}
+	if _, ok := measure(reflect.Zero(t)); !ok {
+		return nil, fmt.Errorf("not allowed for %s", t)
+	}
+	x, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &bound{text, x}, nil
+}
+
+// measure returns the quantity of v limited by min and max:
+// the value of a number or duration, or the length of a string.
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		return float64(len(v.String())), true
+	}
+	return 0, false
+}
+
+// check reports whether the value v, parsed from text, satisfies
+// the constraints of f.
+func (f *field) check(v reflect.Value, text string) error {
+	if f.pattern != nil && !f.pattern.MatchString(text) {
+		return fmt.Errorf("%q does not match %s", text, f.patText)
+	}
+	x, _ := measure(v)
+	what := "value"
+	if v.Kind() == reflect.String {
+		what = "length"
+	}
+	if f.min != nil && x < f.min.x {
+		return fmt.Errorf("%s must be at least %s", what, f.min.text)
+	}
+	if f.max != nil && x > f.max.x {
+		return fmt.Errorf("%s must be at most %s", what, f.max.text)
+	}
+	return nil
+}
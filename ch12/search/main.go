@@ -52,9 +52,11 @@ $ ./fetch 'http://localhost:12345/search?l=golang&l=programming&max=100'
 Search: {Labels:[golang programming] MaxResults:100 Exact:false}
 $ ./fetch 'http://localhost:12345/search?x=true&l=golang&l=programming'
 Search: {Labels:[golang programming] MaxResults:10 Exact:true}
-$ ./fetch 'http://localhost:12345/search?q=hello&x=123'
+$ ./fetch 'http://localhost:12345/search?x=123'
 x: strconv.ParseBool: parsing "123": invalid syntax
-$ ./fetch 'http://localhost:12345/search?q=hello&max=lots'
+$ ./fetch 'http://localhost:12345/search?max=lots'
 max: strconv.ParseInt: parsing "lots": invalid syntax
+$ ./fetch 'http://localhost:12345/search?q=hello&max=lots'
+max: strconv.ParseInt: parsing "lots": invalid syntax (and 1 more errors)
 //!-output
 */
@@ -9,7 +9,9 @@ package sexpr
 
 import (
 	"bytes"
+	"encoding"
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
 	"text/scanner"
@@ -19,9 +21,8 @@ import (
 // Unmarshal parses S-expression data and populates the variable
 // whose address is in the non-nil pointer out.
 func Unmarshal(data []byte, out interface{}) (err error) {
-	lex := &lexer{scan: scanner.Scanner{Mode: scanner.GoTokens}}
-	lex.scan.Init(bytes.NewReader(data))
-	lex.next() // get the first token
+	lex := new(lexer)
+	lex.init(bytes.NewReader(data))
 	defer func() {
 		// NOTE: this is not an example of ideal error handling.
 		if x := recover(); x != nil {
@@ -34,17 +35,81 @@ func Unmarshal(data []byte, out interface{}) (err error) {
 
 //!-Unmarshal
 
+// Unmarshaler is implemented by types that can decode their own
+// S-expression representation.  The data passed to UnmarshalSexpr
+// is a single well-formed value; lists are normalized so that
+// their elements are separated by single spaces.
+type Unmarshaler interface {
+	UnmarshalSexpr(data []byte) error
+}
+
+var (
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
 //!+lexer
 type lexer struct {
-	scan  scanner.Scanner
-	token rune // the current token
+	scan   scanner.Scanner
+	token  rune // the current token
+	peeked bool // token has been scanned but not consumed
+	held   bool // token is a ')' that is still the scanner's lookahead
 }
 
-func (lex *lexer) next()        { lex.token = lex.scan.Scan() }
-func (lex *lexer) text() string { return lex.scan.TokenText() }
+// peek returns the current token, scanning it if necessary.
+// Comments, from ; to the end of the line, are skipped.
+//
+// The scanner always reads one character beyond a token, so a
+// Decoder would block after the ')' that ends a value until more
+// input arrives.  Instead, peek recognizes a ')' in the scanner's
+// lookahead as a token, and leaves it to be consumed when the next
+// token is needed.  Tokens are scanned only on demand, so a Decoder
+// never blocks reading beyond the end of a list it is decoding.
+func (lex *lexer) peek() rune {
+	for !lex.peeked {
+		if lex.held {
+			lex.scan.Next() // consume the ')'
+			lex.held = false
+		}
+		ch := lex.scan.Peek()
+		for ch >= 0 && ch < 64 && lex.scan.Whitespace&(1<<uint(ch)) != 0 {
+			lex.scan.Next()
+			ch = lex.scan.Peek()
+		}
+		if ch == ')' {
+			lex.scan.Position = lex.scan.Pos()
+			lex.token, lex.peeked, lex.held = ')', true, true
+			break
+		}
+		lex.token = lex.scan.Scan()
+		if lex.token == ';' {
+			for ch := lex.scan.Next(); ch != '\n' && ch != scanner.EOF; {
+				ch = lex.scan.Next()
+			}
+			continue
+		}
+		lex.peeked = true
+	}
+	return lex.token
+}
+
+// init prepares lex to read from r.
+func (lex *lexer) init(r io.Reader) {
+	lex.scan.Mode = scanner.GoTokens
+	lex.scan.IsIdentRune = isSymbolRune
+	lex.scan.Init(r)
+}
+
+func (lex *lexer) next() { lex.peek(); lex.peeked = false }
+func (lex *lexer) text() string {
+	if lex.held {
+		return ")"
+	}
+	return lex.scan.TokenText()
+}
 
 func (lex *lexer) consume(want rune) {
-	if lex.token != want { // NOTE: Not an example of good error handling.
+	if lex.peek() != want { // NOTE: Not an example of good error handling.
 		panic(fmt.Sprintf("got %q, want %q", lex.text(), want))
 	}
 	lex.next()
@@ -59,40 +124,78 @@ func (lex *lexer) consume(want rune) {
 // The parser assumes
 // - that the S-expression input is well-formed; it does no error checking.
 // - that the S-expression input corresponds to the type of the variable.
-// - that all numbers in the input are non-negative decimal integers.
+// - that all numbers in the input are decimal, or Common Lisp
+//   complex numbers such as #C(1.0 -2.5).
 // - that all keys in ((key value) ...) struct syntax are unquoted symbols.
+//   Keys that name no field are skipped.
 // - that the input does not contain dotted lists such as (1 2 . 3).
 // - that the input does not contain Lisp reader macros such 'x and #'x.
 //
 // The reflection logic assumes
 // - that v is always a variable of the appropriate type for the
-//   S-expression value.  For example, v must not be a boolean,
-//   interface, channel, or function, and if v is an array, the input
-//   must have the correct number of elements.
+//   S-expression value.  For example, v must not be a channel or
+//   function, and if v is an array, the input must have the correct
+//   number of elements.  Pointers are allocated as needed, and types
+//   that implement Unmarshaler or encoding.TextUnmarshaler decode
+//   themselves.  Interface values must be of registered types.
 // - that v in the top-level call to read has the zero value of its
 //   type and doesn't need clearing.
-// - that if v is a numeric variable, it is a signed integer.
 
 //!+read
 func read(lex *lexer, v reflect.Value) {
-	switch lex.token {
+	isNil := lex.peek() == scanner.Ident && lex.text() == "nil"
+	if v.Kind() == reflect.Ptr && !isNil {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		read(lex, v.Elem())
+		return
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(unmarshalerType) {
+		var buf bytes.Buffer
+		readRaw(lex, &buf)
+		u := v.Addr().Interface().(Unmarshaler)
+		if err := u.UnmarshalSexpr(buf.Bytes()); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if !isNil && v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		if lex.peek() != scanner.String {
+			panic(fmt.Sprintf("got %q, want string for %v", lex.text(), v.Type()))
+		}
+		s, _ := strconv.Unquote(lex.text()) // NOTE: ignoring errors
+		u := v.Addr().Interface().(encoding.TextUnmarshaler)
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			panic(err)
+		}
+		lex.next()
+		return
+	}
+	switch lex.peek() {
 	case scanner.Ident:
-		// The only valid identifiers are
-		// "nil" and struct field names.
-		if lex.text() == "nil" {
+		// The only valid identifiers are "nil",
+		// "t" (true), and struct field names.
+		if isNil {
 			v.Set(reflect.Zero(v.Type()))
 			lex.next()
 			return
 		}
+		if lex.text() == "t" && v.Kind() == reflect.Bool {
+			v.SetBool(true)
+			lex.next()
+			return
+		}
 	case scanner.String:
 		s, _ := strconv.Unquote(lex.text()) // NOTE: ignoring errors
 		v.SetString(s)
 		lex.next()
 		return
-	case scanner.Int:
-		i, _ := strconv.Atoi(lex.text()) // NOTE: ignoring errors
-		v.SetInt(int64(i))
-		lex.next()
+	case scanner.Int, scanner.Float, '-':
+		readNumber(lex, v)
+		return
+	case '#':
+		v.SetComplex(readComplex(lex))
 		return
 	case '(':
 		lex.next()
@@ -123,15 +226,36 @@ func readList(lex *lexer, v reflect.Value) {
 	case reflect.Struct: // ((name value) ...)
 		for !endList(lex) {
 			lex.consume('(')
-			if lex.token != scanner.Ident {
+			if lex.peek() != scanner.Ident {
 				panic(fmt.Sprintf("got token %q, want field name", lex.text()))
 			}
 			name := lex.text()
 			lex.next()
-			read(lex, v.FieldByName(name))
+			if f := fieldByName(v, name); f.IsValid() {
+				read(lex, f)
+			} else {
+				readRaw(lex, new(bytes.Buffer)) // skip unknown field
+			}
 			lex.consume(')')
 		}
 
+	case reflect.Interface: // ("TypeName" value)
+		if lex.peek() != scanner.String {
+			panic(fmt.Sprintf("got %q, want type name", lex.text()))
+		}
+		name, _ := strconv.Unquote(lex.text()) // NOTE: ignoring errors
+		t, ok := typeByName(name)
+		if !ok {
+			panic(fmt.Sprintf("unregistered type %q", name))
+		}
+		if !t.Implements(v.Type()) {
+			panic(fmt.Sprintf("type %s does not implement %s", t, v.Type()))
+		}
+		lex.next()
+		item := reflect.New(t).Elem()
+		read(lex, item)
+		v.Set(item)
+
 	case reflect.Map: // ((key value) ...)
 		v.Set(reflect.MakeMap(v.Type()))
 		for !endList(lex) {
@@ -150,7 +274,7 @@ func readList(lex *lexer, v reflect.Value) {
 }
 
 func endList(lex *lexer) bool {
-	switch lex.token {
+	switch lex.peek() {
 	case scanner.EOF:
 		panic("end of file")
 	case ')':
@@ -160,3 +284,93 @@ func endList(lex *lexer) bool {
 }
 
 //!-readlist
+
+// readNumber consumes an optionally negated number and stores it in
+// the integer or floating-point variable v.
+func readNumber(lex *lexer, v reflect.Value) {
+	text := ""
+	if lex.peek() == '-' {
+		text = "-"
+		lex.next()
+	}
+	if tok := lex.peek(); tok != scanner.Int && tok != scanner.Float {
+		panic(fmt.Sprintf("got %q, want number", lex.text()))
+	}
+	text += lex.text()
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			panic(err)
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(text, 10, v.Type().Bits())
+		if err != nil {
+			panic(err)
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			panic(err)
+		}
+		v.SetFloat(f)
+
+	default:
+		panic(fmt.Sprintf("cannot decode number %s into %v", text, v.Type()))
+	}
+	lex.next()
+}
+
+// readComplex consumes a complex number, #C(re im).
+func readComplex(lex *lexer) complex128 {
+	lex.consume('#')
+	if lex.peek() != scanner.Ident || lex.text() != "C" {
+		panic(fmt.Sprintf("got %q after #, want C", lex.text()))
+	}
+	lex.next()
+	lex.consume('(')
+	var re, im float64
+	readNumber(lex, reflect.ValueOf(&re).Elem())
+	readNumber(lex, reflect.ValueOf(&im).Elem())
+	lex.consume(')')
+	return complex(re, im)
+}
+
+// readRaw consumes the next value, appending its text to buf.
+func readRaw(lex *lexer, buf *bytes.Buffer) {
+	switch lex.peek() {
+	case '(':
+		lex.next()
+		buf.WriteByte('(')
+		for i := 0; !endList(lex); i++ {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			readRaw(lex, buf)
+		}
+		lex.next()
+		buf.WriteByte(')')
+	case scanner.EOF:
+		panic("end of file")
+	case ')':
+		panic(fmt.Sprintf("unexpected token %q", lex.text()))
+	case '-': // a negative number
+		buf.WriteString("-")
+		lex.next()
+		readRaw(lex, buf)
+	case '#': // a complex number, #C(re im)
+		buf.WriteString("#")
+		lex.next()
+		readRaw(lex, buf)
+		readRaw(lex, buf)
+	default:
+		buf.WriteString(lex.text())
+		lex.next()
+	}
+}
@@ -7,8 +7,11 @@ package sexpr
 
 import (
 	"bytes"
+	"encoding"
 	"fmt"
+	"io"
 	"reflect"
+	"strconv"
 )
 
 //!+Marshal
@@ -23,9 +26,54 @@ func Marshal(v interface{}) ([]byte, error) {
 
 //!-Marshal
 
+// Marshaler is implemented by types that can encode themselves as
+// S-expressions.  MarshalSexpr must return a single well-formed value.
+type Marshaler interface {
+	MarshalSexpr() ([]byte, error)
+}
+
+// marshal returns the encoding of v produced by its MarshalSexpr
+// method, or by its MarshalText method as a string, if it has one.
+func marshal(v reflect.Value) (data []byte, ok bool, err error) {
+	switch {
+	case !v.IsValid(), !v.CanInterface(),
+		v.Kind() == reflect.Ptr && v.IsNil(),
+		v.Kind() == reflect.Interface: // encoded with its type name
+		return nil, false, nil
+	}
+	x := v.Interface()
+	if v.CanAddr() {
+		x = v.Addr().Interface() // include pointer methods
+	}
+	switch x := x.(type) {
+	case Marshaler:
+		data, err = x.MarshalSexpr()
+		return data, true, err
+	case encoding.TextMarshaler:
+		text, err := x.MarshalText()
+		return []byte(strconv.Quote(string(text))), true, err
+	}
+	return nil, false, nil
+}
+
+// A writer is the destination of encode: a *bytes.Buffer for
+// Marshal or a *bufio.Writer for an Encoder.
+type writer interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
 // encode writes to buf an S-expression representation of v.
 //!+encode
-func encode(buf *bytes.Buffer, v reflect.Value) error {
+func encode(buf writer, v reflect.Value) error {
+	if data, ok, err := marshal(v); ok {
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
 	switch v.Kind() {
 	case reflect.Invalid:
 		buf.WriteString("nil")
@@ -41,9 +89,41 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 	case reflect.String:
 		fmt.Fprintf(buf, "%q", v.String())
 
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteString("t")
+		} else {
+			buf.WriteString("nil")
+		}
+
+	case reflect.Float32, reflect.Float64:
+		s, err := formatFloat(v.Float(), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+
+	case reflect.Complex64, reflect.Complex128:
+		s, err := formatComplex(v.Complex(), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+
 	case reflect.Ptr:
 		return encode(buf, v.Elem())
 
+	case reflect.Interface: // ("TypeName" value)
+		if v.IsNil() {
+			buf.WriteString("nil")
+			break
+		}
+		fmt.Fprintf(buf, "(%q ", typeName(v.Elem().Type()))
+		if err := encode(buf, v.Elem()); err != nil {
+			return err
+		}
+		buf.WriteByte(')')
+
 	case reflect.Array, reflect.Slice: // (value ...)
 		buf.WriteByte('(')
 		for i := 0; i < v.Len(); i++ {
@@ -58,12 +138,18 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 
 	case reflect.Struct: // ((name value) ...)
 		buf.WriteByte('(')
-		for i := 0; i < v.NumField(); i++ {
-			if i > 0 {
+		sep := false
+		for _, f := range fields(v.Type()) {
+			fv := v.Field(f.index)
+			if f.omitEmpty && isEmpty(fv) {
+				continue
+			}
+			if sep {
 				buf.WriteByte(' ')
 			}
-			fmt.Fprintf(buf, "(%s ", v.Type().Field(i).Name)
-			if err := encode(buf, v.Field(i)); err != nil {
+			sep = true
+			fmt.Fprintf(buf, "(%s ", f.name)
+			if err := encode(buf, fv); err != nil {
 				return err
 			}
 			buf.WriteByte(')')
@@ -88,7 +174,7 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 		}
 		buf.WriteByte(')')
 
-	default: // float, complex, bool, chan, func, interface
+	default: // chan, func, unsafe.Pointer
 		return fmt.Errorf("unsupported type: %s", v.Type())
 	}
 	return nil
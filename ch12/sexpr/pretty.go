@@ -10,21 +10,55 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 )
 
+// MarshalIndent is like Marshal but breaks its output into lines
+// of at most 80 columns where possible, and sorts map entries by key.
 func MarshalIndent(v interface{}) ([]byte, error) {
-	p := printer{width: margin}
+	return MarshalIndentOptions{SortMapKeys: true}.Marshal(v)
+}
+
+// MarshalIndentOptions controls the layout of indented output.
+type MarshalIndentOptions struct {
+	// Width is the maximum line length, if possible; zero means 80.
+	Width int
+
+	// Indent is the indentation of a continuation line relative to
+	// the parenthesis that opens its list.  Zero means 1, which
+	// aligns the line with the first element of the list.
+	Indent int
+
+	// Comments causes each struct field with a comment tag,
+	//	Year int `comment:"year of release"`
+	// to be followed on its line by a comment, ; year of release.
+	Comments bool
+
+	// SortMapKeys causes map entries to be printed in key order.
+	// Otherwise their order is unspecified.
+	SortMapKeys bool
+}
+
+// Marshal encodes v in S-expression form, laid out according to o.
+func (o MarshalIndentOptions) Marshal(v interface{}) ([]byte, error) {
+	p := printer{opts: o, margin: o.Width, indent: o.Indent}
+	if p.margin <= 0 {
+		p.margin = 80
+	}
+	if p.indent <= 0 {
+		p.indent = 1
+	}
+	p.width = p.margin
 	if err := pretty(&p, reflect.ValueOf(v)); err != nil {
 		return nil, err
 	}
 	return p.Bytes(), nil
 }
 
-const margin = 80
-
 type token struct {
-	kind rune // one of "s ()" (string, blank, start, end)
-	str  string
+	kind rune   // one of "s ();" (string, blank, start, end, comment)
+	str  string // text of string or comment; "\n" for a forced blank
 	size int
 }
 
@@ -35,7 +69,11 @@ type printer struct {
 
 	bytes.Buffer
 	indents []int
-	width   int // remaining space
+	width   int    // remaining space
+	comment string // comment to print at the end of the line
+
+	opts           MarshalIndentOptions
+	margin, indent int // line width and indentation
 }
 
 func (p *printer) string(str string) {
@@ -74,6 +112,22 @@ func (p *printer) end() {
 			p.print(tok)
 		}
 		p.tokens = nil
+		p.flushComment()
+	}
+}
+
+// lineComment adds a comment to be printed at the end of the line
+// on which the preceding token appears.  It forces a line break at
+// the next blank, so that no further tokens are commented out.
+func (p *printer) lineComment(text string) {
+	text = strings.Join(strings.Fields(text), " ") // one line
+	p.tokens = append(p.tokens, &token{kind: ';', str: text})
+}
+
+func (p *printer) flushComment() {
+	if p.comment != "" {
+		fmt.Fprintf(&p.Buffer, " ; %s", p.comment)
+		p.comment = ""
 	}
 }
 func (p *printer) space() {
@@ -88,6 +142,12 @@ func (p *printer) space() {
 	p.stack = append(p.stack, t)
 	p.rtotal++
 }
+
+// newline is like space but always breaks the line.
+func (p *printer) newline() {
+	p.space()
+	p.tokens[len(p.tokens)-1].str = "\n"
+}
 func (p *printer) print(t *token) {
 	switch t.kind {
 	case 's':
@@ -97,10 +157,17 @@ func (p *printer) print(t *token) {
 		p.indents = append(p.indents, p.width)
 	case ')':
 		p.indents = p.indents[:len(p.indents)-1] // pop
+	case ';':
+		if p.comment != "" {
+			p.comment += "; " + t.str
+		} else {
+			p.comment = t.str
+		}
 	case ' ':
-		if t.size > p.width {
-			p.width = p.indents[len(p.indents)-1] - 1
-			fmt.Fprintf(&p.Buffer, "\n%*s", margin-p.width, "")
+		if t.size > p.width || t.str == "\n" || p.comment != "" {
+			p.flushComment()
+			p.width = p.indents[len(p.indents)-1] - p.indent
+			fmt.Fprintf(&p.Buffer, "\n%*s", p.margin-p.width, "")
 		} else {
 			p.WriteByte(' ')
 			p.width--
@@ -112,6 +179,13 @@ func (p *printer) stringf(format string, args ...interface{}) {
 }
 
 func pretty(p *printer, v reflect.Value) error {
+	if data, ok, err := marshal(v); ok {
+		if err != nil {
+			return err
+		}
+		p.string(string(data))
+		return nil
+	}
 	switch v.Kind() {
 	case reflect.Invalid:
 		p.string("nil")
@@ -127,6 +201,40 @@ func pretty(p *printer, v reflect.Value) error {
 	case reflect.String:
 		p.stringf("%q", v.String())
 
+	case reflect.Bool:
+		if v.Bool() {
+			p.string("t")
+		} else {
+			p.string("nil")
+		}
+
+	case reflect.Float32, reflect.Float64:
+		s, err := formatFloat(v.Float(), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		p.string(s)
+
+	case reflect.Complex64, reflect.Complex128:
+		s, err := formatComplex(v.Complex(), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		p.string(s)
+
+	case reflect.Interface: // ("TypeName" value)
+		if v.IsNil() {
+			p.string("nil")
+			break
+		}
+		p.begin()
+		p.stringf("%q", typeName(v.Elem().Type()))
+		p.space()
+		if err := pretty(p, v.Elem()); err != nil {
+			return err
+		}
+		p.end()
+
 	case reflect.Array, reflect.Slice: // (value ...)
 		p.begin()
 		for i := 0; i < v.Len(); i++ {
@@ -141,23 +249,39 @@ func pretty(p *printer, v reflect.Value) error {
 
 	case reflect.Struct: // ((name value ...)
 		p.begin()
-		for i := 0; i < v.NumField(); i++ {
-			if i > 0 {
+		sep := false
+		for _, f := range fields(v.Type()) {
+			fv := v.Field(f.index)
+			if f.omitEmpty && isEmpty(fv) {
+				continue
+			}
+			comment := p.opts.Comments && f.comment != ""
+			if sep && comment {
+				p.newline() // begin commented fields on a new line
+			} else if sep {
 				p.space()
 			}
+			sep = true
 			p.begin()
-			p.string(v.Type().Field(i).Name)
+			p.string(f.name)
 			p.space()
-			if err := pretty(p, v.Field(i)); err != nil {
+			if err := pretty(p, fv); err != nil {
 				return err
 			}
 			p.end()
+			if comment {
+				p.lineComment(f.comment)
+			}
 		}
 		p.end()
 
 	case reflect.Map: // ((key value ...)
 		p.begin()
-		for i, key := range v.MapKeys() {
+		keys := v.MapKeys()
+		if p.opts.SortMapKeys {
+			sortKeys(keys)
+		}
+		for i, key := range keys {
 			if i > 0 {
 				p.space()
 			}
@@ -176,8 +300,36 @@ func pretty(p *printer, v reflect.Value) error {
 	case reflect.Ptr:
 		return pretty(p, v.Elem())
 
-	default: // float, complex, bool, chan, func, interface
+	default: // chan, func, unsafe.Pointer
 		return fmt.Errorf("unsupported type: %s", v.Type())
 	}
 	return nil
 }
+
+// sortKeys sorts map keys: numbers and strings by value, booleans
+// false first, and other types by their encoding.
+func sortKeys(keys []reflect.Value) {
+	less := func(x, y reflect.Value) bool {
+		var bx, by bytes.Buffer
+		encode(&bx, x) // errors are reported when the key is printed
+		encode(&by, y)
+		return bx.String() < by.String()
+	}
+	if len(keys) > 0 {
+		switch keys[0].Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16,
+			reflect.Int32, reflect.Int64:
+			less = func(x, y reflect.Value) bool { return x.Int() < y.Int() }
+		case reflect.Uint, reflect.Uint8, reflect.Uint16,
+			reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			less = func(x, y reflect.Value) bool { return x.Uint() < y.Uint() }
+		case reflect.Float32, reflect.Float64:
+			less = func(x, y reflect.Value) bool { return x.Float() < y.Float() }
+		case reflect.String:
+			less = func(x, y reflect.Value) bool { return x.String() < y.String() }
+		case reflect.Bool:
+			less = func(x, y reflect.Value) bool { return !x.Bool() && y.Bool() }
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+}
@@ -0,0 +1,122 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type film struct {
+	Title  string            `comment:"as released in the US"`
+	Year   int               `sexpr:"year" comment:"of release"`
+	Actor  map[string]string `sexpr:"actor"`
+	Oscars []string          `comment:"nominations"`
+	Reels  map[int]bool
+}
+
+var strangelove = film{
+	Title: "Dr. Strangelove",
+	Year:  1964,
+	Actor: map[string]string{
+		"Dr. Strangelove":           "Peter Sellers",
+		"Gen. Buck Turgidson":       "George C. Scott",
+		"Brig. Gen. Jack D. Ripper": "Sterling Hayden",
+	},
+	Oscars: []string{"Best Actor (Nomin.)", "Best Picture (Nomin.)"},
+	Reels:  map[int]bool{10: true, 9: false, -1: true},
+}
+
+func TestMarshalIndentOptions(t *testing.T) {
+	for _, test := range []struct {
+		opts MarshalIndentOptions
+		want string
+	}{
+		{MarshalIndentOptions{SortMapKeys: true}, `
+((Title "Dr. Strangelove") (year 1964)
+ (actor
+  (("Brig. Gen. Jack D. Ripper" "Sterling Hayden")
+   ("Dr. Strangelove" "Peter Sellers")
+   ("Gen. Buck Turgidson" "George C. Scott")))
+ (Oscars ("Best Actor (Nomin.)" "Best Picture (Nomin.)"))
+ (Reels ((-1 t) (9 nil) (10 t))))`},
+
+		{MarshalIndentOptions{Width: 40, Indent: 2, SortMapKeys: true}, `
+((Title "Dr. Strangelove") (year 1964)
+  (actor
+    (("Brig. Gen. Jack D. Ripper"
+       "Sterling Hayden")
+      ("Dr. Strangelove"
+        "Peter Sellers")
+      ("Gen. Buck Turgidson"
+        "George C. Scott")))
+  (Oscars
+    ("Best Actor (Nomin.)"
+      "Best Picture (Nomin.)"))
+  (Reels ((-1 t) (9 nil) (10 t))))`},
+
+		// Commented fields begin new lines, and the comment
+		// follows any closing parentheses on the same line.
+		{MarshalIndentOptions{Width: 200, Comments: true, SortMapKeys: true}, `
+((Title "Dr. Strangelove") ; as released in the US
+ (year 1964) ; of release
+ (actor (("Brig. Gen. Jack D. Ripper" "Sterling Hayden") ("Dr. Strangelove" "Peter Sellers") ("Gen. Buck Turgidson" "George C. Scott")))
+ (Oscars ("Best Actor (Nomin.)" "Best Picture (Nomin.)")) ; nominations
+ (Reels ((-1 t) (9 nil) (10 t))))`},
+	} {
+		data, err := test.opts.Marshal(strangelove)
+		if err != nil {
+			t.Errorf("%+v.Marshal: %v", test.opts, err)
+			continue
+		}
+		if got, want := string(data), test.want[1:]; got != want {
+			t.Errorf("%+v.Marshal =\n%s\nwant\n%s", test.opts, got, want)
+		}
+
+		var f film
+		if err := Unmarshal(data, &f); err != nil {
+			t.Errorf("Unmarshal(%s): %v", data, err)
+		} else if !reflect.DeepEqual(f, strangelove) {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", data, f, strangelove)
+		}
+	}
+}
+
+func TestMarshalIndentComments(t *testing.T) {
+	type note struct {
+		Text string "comment:\"two\\n  lines\""
+	}
+	type pair struct{ X, Y note }
+	data, err := MarshalIndentOptions{Comments: true}.Marshal(pair{note{"a"}, note{"b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last field's comment appears after the closing parentheses.
+	const want = `((X ((Text "a"))) ; two lines
+ (Y ((Text "b")))) ; two lines`
+	if string(data) != want {
+		t.Errorf("Marshal =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestMarshalIndentDeterministic(t *testing.T) {
+	m := make(map[interface{}]int)
+	for i, k := range []interface{}{"b", 3, "a", 1.5, true, nil} {
+		m[k] = i
+	}
+	first, err := MarshalIndent(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		data, _ := MarshalIndent(m)
+		if string(data) != string(first) {
+			t.Fatalf("MarshalIndent output varies:\n%s\n%s", first, data)
+		}
+	}
+	if !strings.HasPrefix(string(first), `((("bool" t) 4)`) {
+		t.Errorf("MarshalIndent = %s, want entries ordered by encoding", first)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"text/scanner"
+)
+
+// A Decoder reads and decodes S-expressions from an input stream.
+type Decoder struct {
+	lex lexer
+}
+
+// NewDecoder returns a new decoder that reads from r.
+// Values in the stream may be separated by white space.
+func NewDecoder(r io.Reader) *Decoder {
+	dec := new(Decoder)
+	dec.lex.init(r)
+	return dec
+}
+
+// Decode reads the next S-expression from the stream and stores it
+// in the variable whose address is in the non-nil pointer out.
+// At the end of the stream, it returns io.EOF.
+//
+// Decode returns a list as soon as it reads the closing parenthesis,
+// without waiting for more input, so it suits request-reply protocols.
+// An atom such as 42 ends only at the next character, though.
+func (dec *Decoder) Decode(out interface{}) (err error) {
+	lex := &dec.lex
+	if lex.peek() == scanner.EOF {
+		return io.EOF
+	}
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("error at %s: %v", lex.scan.Position, x)
+		}
+	}()
+	read(lex, reflect.ValueOf(out).Elem())
+	return nil
+}
+
+// More reports whether there is another element in the
+// current list, or another value in the stream.
+func (dec *Decoder) More() bool {
+	tok := dec.lex.peek()
+	return tok != ')' && tok != scanner.EOF
+}
+
+// A Token is one of Symbol, String, Int, Float, Complex,
+// StartList, or EndList.
+type Token interface{}
+
+type (
+	Symbol    string     // an unquoted identifier such as nil or a field name
+	String    string     // a quoted string literal, unquoted
+	Int       int64      // a decimal integer
+	Float     float64    // a decimal floating-point number
+	Complex   complex128 // a complex number, #C(re im)
+	StartList struct{}   // an opening parenthesis
+	EndList   struct{}   // a closing parenthesis
+)
+
+// Token returns the next token in the input stream.
+// At the end of the stream, it returns nil, io.EOF.
+//
+// Token does not check that lists are balanced.  Calls to Token
+// may be interleaved with calls to Decode, for example to decode
+// the elements of a long list one at a time.
+func (dec *Decoder) Token() (tok Token, err error) {
+	lex := &dec.lex
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("error at %s: %v", lex.scan.Position, x)
+		}
+	}()
+	switch lex.peek() {
+	case scanner.EOF:
+		return nil, io.EOF
+	case scanner.Ident:
+		tok = Symbol(lex.text())
+	case scanner.String:
+		s, err := strconv.Unquote(lex.text())
+		if err != nil {
+			panic(err)
+		}
+		tok = String(s)
+	case scanner.Int, scanner.Float, '-':
+		sign := ""
+		if lex.peek() == '-' {
+			sign = "-"
+			lex.next()
+		}
+		switch lex.peek() {
+		case scanner.Int:
+			i, err := strconv.ParseInt(sign+lex.text(), 10, 64)
+			if err != nil {
+				panic(err)
+			}
+			tok = Int(i)
+		case scanner.Float:
+			f, err := strconv.ParseFloat(sign+lex.text(), 64)
+			if err != nil {
+				panic(err)
+			}
+			tok = Float(f)
+		default:
+			panic(fmt.Sprintf("got %q, want number", lex.text()))
+		}
+	case '#':
+		return Complex(readComplex(lex)), nil
+	case '(':
+		tok = StartList{}
+	case ')':
+		tok = EndList{}
+	default:
+		panic(fmt.Sprintf("unexpected token %q", lex.text()))
+	}
+	lex.next()
+	return tok, nil
+}
+
+// An Encoder writes S-expressions to an output stream.
+type Encoder struct {
+	w *bufio.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{bufio.NewWriter(w)}
+}
+
+// Encode writes the S-expression encoding of v to the stream,
+// followed by a newline.  Unlike Marshal, it does not hold the
+// whole encoding in memory, so if v cannot be encoded, a prefix
+// of its encoding may already have been written.
+func (enc *Encoder) Encode(v interface{}) error {
+	if err := encode(enc.w, reflect.ValueOf(v)); err != nil {
+		enc.w.Flush()
+		return err
+	}
+	enc.w.WriteByte('\n')
+	return enc.w.Flush()
+}
@@ -0,0 +1,207 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type point struct{ X, Y int }
+
+func TestDecoder(t *testing.T) {
+	// Concatenated values of different types in one stream.
+	dec := NewDecoder(strings.NewReader(`(1 2 3)"hello" 42
+((X 1) (Y 2))  (("a" 1))
+nil`))
+	var ints []int
+	var s string
+	var n int
+	var p point
+	var m map[string]int
+	var q *point
+	for _, out := range []interface{}{&ints, &s, &n, &p, &m, &q} {
+		if err := dec.Decode(out); err != nil {
+			t.Fatalf("Decode(%T): %v", out, err)
+		}
+	}
+	if err := dec.Decode(&n); err != io.EOF {
+		t.Errorf("Decode at end of stream returned %v, want io.EOF", err)
+	}
+	got := []interface{}{ints, s, n, p, m, q}
+	want := []interface{}{[]int{1, 2, 3}, "hello", 42, point{1, 2},
+		map[string]int{"a": 1}, (*point)(nil)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode returned %v, want %v", got, want)
+	}
+}
+
+func TestDecoderError(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("(1 2"))
+	var ints []int
+	err := dec.Decode(&ints)
+	if err == nil || !strings.Contains(err.Error(), "end of file") {
+		t.Errorf("Decode of truncated list returned %v, want end of file error", err)
+	}
+}
+
+func TestToken(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`((Name "x\ty") ; a comment
+ (Sizes (1 -23 2.5 #C(1 -0.5)))) t`))
+	var got []Token
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tok)
+	}
+	want := []Token{
+		StartList{},
+		StartList{}, Symbol("Name"), String("x\ty"), EndList{},
+		StartList{}, Symbol("Sizes"),
+		StartList{}, Int(1), Int(-23), Float(2.5), Complex(1 - 0.5i), EndList{},
+		EndList{},
+		EndList{},
+		Symbol("t"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Token sequence = %v, want %v", got, want)
+	}
+
+	if _, err := NewDecoder(strings.NewReader("@")).Token(); err == nil {
+		t.Errorf("Token(@) succeeded, want error")
+	}
+}
+
+// TestTokenDecode decodes the elements of a list one at a time.
+func TestTokenDecode(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("(((X 1) (Y 2)) ((X 3) (Y 4)))"))
+	if tok, err := dec.Token(); err != nil || tok != (StartList{}) {
+		t.Fatalf("Token() = %v, %v, want StartList", tok, err)
+	}
+	var points []point
+	for dec.More() {
+		var p point
+		if err := dec.Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		points = append(points, p)
+	}
+	if tok, err := dec.Token(); err != nil || tok != (EndList{}) {
+		t.Fatalf("Token() = %v, %v, want EndList", tok, err)
+	}
+	if want := []point{{1, 2}, {3, 4}}; !reflect.DeepEqual(points, want) {
+		t.Errorf("decoded %v, want %v", points, want)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	values := []interface{}{
+		[]int{1, 2, 3},
+		"hello",
+		point{1, 2},
+		map[string]int{"a": 1},
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("Encode(%v): %v", v, err)
+		}
+	}
+	const want = `(1 2 3)
+"hello"
+((X 1) (Y 2))
+(("a" 1))
+`
+	if buf.String() != want {
+		t.Errorf("Encode wrote %q, want %q", buf.String(), want)
+	}
+
+	// Decode the stream back into values of the same types.
+	dec := NewDecoder(&buf)
+	for _, v := range values {
+		ptr := reflect.New(reflect.TypeOf(v))
+		if err := dec.Decode(ptr.Interface()); err != nil {
+			t.Fatalf("Decode(%T): %v", v, err)
+		}
+		if got := ptr.Elem().Interface(); !reflect.DeepEqual(got, v) {
+			t.Errorf("round trip of %v yielded %v", v, got)
+		}
+	}
+
+	if err := enc.Encode(make(chan int)); err == nil {
+		t.Errorf("Encode(chan) succeeded, want error")
+	}
+}
+
+// TestDecoderNoReadAhead checks that Decode returns each value as
+// soon as it is complete, without waiting for the next one.
+func TestDecoderNoReadAhead(t *testing.T) {
+	r, w := io.Pipe()
+	values := make(chan string)
+	go func() {
+		for v := range values {
+			io.WriteString(w, v)
+		}
+		w.Close()
+	}()
+	dec := NewDecoder(r)
+	for i := 0; i < 2; i++ {
+		values <- "(1 2)\n"
+		var ints []int
+		if err := dec.Decode(&ints); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ints, []int{1, 2}) {
+			t.Errorf("Decode returned %v, want [1 2]", ints)
+		}
+	}
+	close(values)
+	var ints []int
+	if err := dec.Decode(&ints); err != io.EOF {
+		t.Errorf("Decode at end of stream returned %v, want io.EOF", err)
+	}
+}
+
+// TestDecoderPipe checks that Decode returns a list as soon as its
+// closing parenthesis arrives, with nothing after it.
+func TestDecoderPipe(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	dec := NewDecoder(r)
+	for _, test := range []struct {
+		input string
+		want  interface{}
+	}{
+		{"(1 2)", []int{1, 2}},
+		{" ((X 3) (Y 4) )", point{3, 4}},
+		{"(#C(1 -2))", []complex128{complex(1, -2)}},
+		{`(("a") ("b" "c"))`, [][]string{{"a"}, {"b", "c"}}},
+	} {
+		go io.WriteString(w, test.input)
+		out := reflect.New(reflect.TypeOf(test.want))
+		done := make(chan error)
+		go func() { done <- dec.Decode(out.Interface()) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Decode(%q): %v", test.input, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Decode(%q) blocked after the end of the value", test.input)
+		}
+		if got := out.Elem().Interface(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Decode(%q) = %v, want %v", test.input, got, test.want)
+		}
+	}
+}
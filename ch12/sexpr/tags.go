@@ -0,0 +1,91 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// A field describes how a struct field is encoded, according to
+// its sexpr tag:
+//
+//	Name string `sexpr:"first-name"`           // encoded as (first-name ...)
+//	Note string `sexpr:",omitempty"`           // omitted if empty
+//	Temp int    `sexpr:"-"`                    // never encoded or decoded
+//	Addr string `sexpr:"mail-address,omitempty"`
+type field struct {
+	name      string // symbol used in the encoding
+	index     int    // index of the field in its struct
+	omitEmpty bool   // omit the field if its value is empty
+	comment   string // the field's comment tag, for MarshalIndent
+}
+
+// fields returns the encoded fields of struct type t, in order.
+func fields(t reflect.Type) []field {
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("sexpr")
+		if tag == "-" {
+			continue
+		}
+		f := field{name: sf.Name, index: i, comment: sf.Tag.Get("comment")}
+		if tag != "" {
+			opts := strings.Split(tag, ",")
+			if opts[0] != "" {
+				f.name = opts[0]
+			}
+			for _, opt := range opts[1:] {
+				if opt == "omitempty" {
+					f.omitEmpty = true
+				}
+			}
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+// fieldByName returns the field of struct v encoded as name,
+// or the zero Value if there is none.
+func fieldByName(v reflect.Value, name string) reflect.Value {
+	for _, f := range fields(v.Type()) {
+		if f.name == name {
+			return v.Field(f.index)
+		}
+	}
+	return reflect.Value{}
+}
+
+// isEmpty reports whether v is false, 0, nil, or of length zero.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Complex64, reflect.Complex128:
+		return v.Complex() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// isSymbolRune reports whether ch may appear at position i of a
+// symbol.  In addition to Go identifiers, symbols may contain
+// hyphens, as in Lisp's kebab-case names.
+func isSymbolRune(ch rune, i int) bool {
+	return ch == '_' || unicode.IsLetter(ch) ||
+		i > 0 && (ch == '-' || unicode.IsDigit(ch))
+}
@@ -0,0 +1,123 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type person struct {
+	FirstName string   `sexpr:"first-name"`
+	LastName  string   `sexpr:"last-name,omitempty"`
+	Age       int      `sexpr:",omitempty"`
+	Nicknames []string `sexpr:"nicknames,omitempty"`
+	Password  string   `sexpr:"-"`
+}
+
+func TestTags(t *testing.T) {
+	for _, test := range []struct {
+		p    person
+		want string
+	}{
+		{person{FirstName: "Grace", LastName: "Hopper", Age: 85},
+			`((first-name "Grace") (last-name "Hopper") (Age 85))`},
+		{person{FirstName: "Ada", Password: "secret"},
+			`((first-name "Ada"))`},
+		{person{Nicknames: []string{"Amazing Grace"}},
+			`((first-name "") (nicknames ("Amazing Grace")))`},
+	} {
+		data, err := Marshal(test.p)
+		if err != nil {
+			t.Errorf("Marshal(%+v): %v", test.p, err)
+			continue
+		}
+		if string(data) != test.want {
+			t.Errorf("Marshal(%+v) = %s, want %s", test.p, data, test.want)
+		}
+		test.p.Password = ""
+		var p person
+		if err := Unmarshal(data, &p); err != nil {
+			t.Errorf("Unmarshal(%s): %v", data, err)
+			continue
+		}
+		if !reflect.DeepEqual(p, test.p) {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", data, p, test.p)
+		}
+	}
+}
+
+func TestUnknownField(t *testing.T) {
+	// Fields absent from the struct, or excluded by "-", are skipped.
+	data := `((first-name "Alan") (Password "x") (born (1912 6 23)) (Age 41))`
+	var p person
+	if err := Unmarshal([]byte(data), &p); err != nil {
+		t.Fatal(err)
+	}
+	if want := (person{FirstName: "Alan", Age: 41}); !reflect.DeepEqual(p, want) {
+		t.Errorf("Unmarshal(%s) = %+v, want %+v", data, p, want)
+	}
+}
+
+// A rational encodes itself as a Lisp ratio, (/ num denom).
+type rational struct{ num, denom int }
+
+func (r rational) MarshalSexpr() ([]byte, error) {
+	if r.denom == 0 {
+		return nil, fmt.Errorf("zero denominator")
+	}
+	return []byte(fmt.Sprintf("(/ %d %d)", r.num, r.denom)), nil
+}
+
+func (r *rational) UnmarshalSexpr(data []byte) error {
+	_, err := fmt.Sscanf(string(data), "(/ %d %d)", &r.num, &r.denom)
+	return err
+}
+
+type event struct {
+	Name  string
+	When  time.Time  `sexpr:"when"`
+	Until *time.Time `sexpr:"until,omitempty"`
+	Ratio rational   `sexpr:"ratio"`
+	Odds  *rational  `sexpr:"odds"`
+}
+
+func TestMarshaler(t *testing.T) {
+	when := time.Date(1969, 7, 20, 20, 17, 40, 0, time.UTC)
+	until := when.Add(21*time.Hour + 36*time.Minute)
+	e := event{"landing", when, &until, rational{1, 3}, &rational{2, 5}}
+
+	data, err := Marshal(e)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	const want = `((Name "landing") (when "1969-07-20T20:17:40Z") ` +
+		`(until "1969-07-21T17:53:40Z") (ratio (/ 1 3)) (odds (/ 2 5)))`
+	if string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+	if data, err := MarshalIndent(e); err != nil || !strings.Contains(string(data), "(ratio (/ 1 3))") {
+		t.Errorf("MarshalIndent = %s, %v", data, err)
+	}
+
+	var got event
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", data, err)
+	}
+	if !reflect.DeepEqual(got, e) {
+		t.Errorf("Unmarshal(%s) = %+v, want %+v", data, got, e)
+	}
+
+	e.Ratio.denom = 0
+	if _, err := Marshal(e); err == nil || err.Error() != "zero denominator" {
+		t.Errorf("Marshal of invalid rational returned %v, want zero denominator", err)
+	}
+	bad := `((when "yesterday"))`
+	if err := Unmarshal([]byte(bad), &got); err == nil {
+		t.Errorf("Unmarshal(%s) succeeded, want error", bad)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// An interface value is encoded as a list of the name of its
+// dynamic type and the encoding of its dynamic value:
+//
+//	("[]int" (1 2 3))
+//
+// To decode it, Unmarshal must know the type by that name.
+// The predeclared boolean, numeric and string types are known
+// already; others must be registered.
+
+var registry struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}
+
+func init() {
+	for _, v := range []interface{}{
+		false, "",
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), float64(0), complex64(0), complex128(0),
+	} {
+		Register(v)
+	}
+}
+
+// Register records the type of value under the name given by its
+// reflect.Type's String method, such as "[]int" or "main.Point".
+func Register(value interface{}) {
+	RegisterName(reflect.TypeOf(value).String(), value)
+}
+
+// RegisterName records the type of value under the specified name.
+// It panics if the name or the type is already registered
+// differently.
+func RegisterName(name string, value interface{}) {
+	t := reflect.TypeOf(value)
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.types == nil {
+		registry.types = make(map[string]reflect.Type)
+		registry.names = make(map[reflect.Type]string)
+	}
+	if old, ok := registry.types[name]; ok && old != t {
+		panic(fmt.Sprintf("sexpr: registering duplicate types for %q: %s != %s", name, old, t))
+	}
+	if old, ok := registry.names[t]; ok && old != name {
+		panic(fmt.Sprintf("sexpr: registering duplicate names for %s: %q != %q", t, old, name))
+	}
+	registry.types[name] = t
+	registry.names[t] = name
+}
+
+// typeName returns the name under which type t is encoded.
+func typeName(t reflect.Type) string {
+	registry.RLock()
+	defer registry.RUnlock()
+	if name, ok := registry.names[t]; ok {
+		return name
+	}
+	return t.String()
+}
+
+// typeByName returns the registered type of the specified name.
+func typeByName(name string) (reflect.Type, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.types[name]
+	return t, ok
+}
+
+// formatFloat returns the shortest decimal representation of f,
+// a float of the specified bit size, that reads back exactly.
+func formatFloat(f float64, bits int) (string, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("unsupported value: %g", f)
+	}
+	return strconv.FormatFloat(f, 'g', -1, bits), nil
+}
+
+// formatComplex returns the Common Lisp notation for c,
+// a complex number of the specified bit size: #C(re im).
+func formatComplex(c complex128, bits int) (string, error) {
+	re, err := formatFloat(real(c), bits/2)
+	if err != nil {
+		return "", err
+	}
+	im, err := formatFloat(imag(c), bits/2)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("#C(%s %s)", re, im), nil
+}
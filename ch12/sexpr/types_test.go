@@ -0,0 +1,122 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type shape interface {
+	area() float64
+}
+
+type circle struct{ Radius float64 }
+type square struct{ Side float64 }
+
+func (c circle) area() float64  { return math.Pi * c.Radius * c.Radius }
+func (s *square) area() float64 { return s.Side * s.Side }
+
+func init() {
+	Register(circle{})
+	RegisterName("square", &square{})
+	Register([]int(nil))
+}
+
+func TestTypes(t *testing.T) {
+	type config struct {
+		Verbose, Quiet bool
+		Ratio          float64
+		Small          float32
+		Impedance      complex128
+		Offset         int8
+		Mask           uint16
+		Any, None      interface{}
+		Shapes         []shape
+	}
+	c := config{
+		Verbose:   true,
+		Ratio:     -1.5e-10,
+		Small:     0.1,
+		Impedance: complex(50, -2.25),
+		Offset:    -128,
+		Mask:      0xffff,
+		Any:       []int{1, -2},
+		Shapes:    []shape{circle{2}, &square{3}, nil},
+	}
+	data, err := Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	const want = `((Verbose t) (Quiet nil) (Ratio -1.5e-10) (Small 0.1) ` +
+		`(Impedance #C(50 -2.25)) (Offset -128) (Mask 65535) ` +
+		`(Any ("[]int" (1 -2))) (None nil) ` +
+		`(Shapes (("sexpr.circle" ((Radius 2))) ("square" ((Side 3))) nil)))`
+	if string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+
+	var got config
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", data, err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("Unmarshal(%s) = %+v, want %+v", data, got, c)
+	}
+
+	pretty, err := MarshalIndent(c)
+	if err != nil {
+		t.Fatalf("MarshalIndent: %v", err)
+	}
+	got = config{}
+	if err := Unmarshal(pretty, &got); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", pretty, err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("Unmarshal(%s) = %+v, want %+v", pretty, got, c)
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	for _, v := range []interface{}{
+		math.Inf(1),
+		complex(0, math.NaN()),
+		[]interface{}{make(chan int)},
+	} {
+		if data, err := Marshal(v); err == nil {
+			t.Errorf("Marshal(%v) = %s, want error", v, data)
+		}
+	}
+
+	for _, test := range []struct {
+		input string
+		out   interface{}
+		want  string // substring of error
+	}{
+		{`("main.unknown" 1)`, new(interface{}), `unregistered type "main.unknown"`},
+		{`("int" 1)`, new(shape), "int does not implement sexpr.shape"},
+		{`300`, new(int8), "value out of range"},
+		{`-1`, new(uint), "invalid syntax"},
+		{`1.5`, new(int), "invalid syntax"},
+		{`t`, new(int), `unexpected token "t"`},
+		{`#X(1 2)`, new(complex128), `got "X" after #, want C`},
+	} {
+		err := Unmarshal([]byte(test.input), test.out)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Unmarshal(%s, %T) returned %v, want error containing %q",
+				test.input, test.out, err, test.want)
+		}
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a second type as %q did not panic", "square")
+		}
+	}()
+	RegisterName("square", circle{})
+}
@@ -0,0 +1,217 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package equal
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"unsafe"
+)
+
+// A Difference describes a place at which two values differ.
+type Difference struct {
+	Path string // the place, such as x.Actors["Han"][2]
+	// X and Y are the values at Path.  One is the zero Value
+	// if its element or map entry is missing.
+	X, Y reflect.Value
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s != %s", d.Path, format(d.X), format(d.Y))
+}
+
+// Options control the comparison made by Diff.
+type Options struct {
+	IgnoreUnexported bool    // skip unexported struct fields
+	NilEqualsEmpty   bool    // treat nil slices and maps as equal to empty ones
+	FloatTolerance   float64 // maximum difference of floats, relative to the larger
+}
+
+// Diff reports the places at which x and y are not deeply equal,
+// in the sense of Equal.  If Equal(x, y), it returns no differences.
+//
+// Paths begin with x, which stands for either argument, and
+// follow pointers and interfaces implicitly.
+func Diff(x, y interface{}) []Difference {
+	return Options{NilEqualsEmpty: true}.Diff(x, y)
+}
+
+// Diff is like the function Diff, but compares according to o.
+func (o Options) Diff(x, y interface{}) []Difference {
+	d := differ{opts: o, seen: make(map[comparison]bool)}
+	d.diff("x", reflect.ValueOf(x), reflect.ValueOf(y))
+	return d.diffs
+}
+
+type differ struct {
+	opts  Options
+	seen  map[comparison]bool
+	diffs []Difference
+}
+
+func (d *differ) report(path string, x, y reflect.Value) {
+	d.diffs = append(d.diffs, Difference{path, x, y})
+}
+
+func (d *differ) diff(path string, x, y reflect.Value) {
+	if !x.IsValid() || !y.IsValid() {
+		if x.IsValid() != y.IsValid() {
+			d.report(path, x, y)
+		}
+		return
+	}
+	if x.Type() != y.Type() {
+		d.report(path, x, y)
+		return
+	}
+
+	// cycle check, as in equal
+	if x.CanAddr() && y.CanAddr() {
+		xptr := unsafe.Pointer(x.UnsafeAddr())
+		yptr := unsafe.Pointer(y.UnsafeAddr())
+		if xptr == yptr {
+			return // identical references
+		}
+		c := comparison{xptr, yptr, x.Type()}
+		if d.seen[c] {
+			return // already seen
+		}
+		d.seen[c] = true
+	}
+
+	switch x.Kind() {
+	case reflect.Bool:
+		if x.Bool() != y.Bool() {
+			d.report(path, x, y)
+		}
+
+	case reflect.String:
+		if x.String() != y.String() {
+			d.report(path, x, y)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		if x.Int() != y.Int() {
+			d.report(path, x, y)
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		if x.Uint() != y.Uint() {
+			d.report(path, x, y)
+		}
+
+	case reflect.Float32, reflect.Float64:
+		if !d.floatEqual(x.Float(), y.Float()) {
+			d.report(path, x, y)
+		}
+
+	case reflect.Complex64, reflect.Complex128:
+		xc, yc := x.Complex(), y.Complex()
+		if !d.floatEqual(real(xc), real(yc)) || !d.floatEqual(imag(xc), imag(yc)) {
+			d.report(path, x, y)
+		}
+
+	case reflect.Chan, reflect.UnsafePointer, reflect.Func:
+		if x.Pointer() != y.Pointer() {
+			d.report(path, x, y)
+		}
+
+	case reflect.Ptr, reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			if x.IsNil() != y.IsNil() {
+				d.report(path, x, y)
+			}
+			return
+		}
+		d.diff(path, x.Elem(), y.Elem())
+
+	case reflect.Array, reflect.Slice:
+		if x.Kind() == reflect.Slice && !d.opts.NilEqualsEmpty && x.IsNil() != y.IsNil() {
+			d.report(path, x, y)
+			return
+		}
+		for i := 0; i < x.Len() || i < y.Len(); i++ {
+			var xi, yi reflect.Value // missing elements are invalid
+			if i < x.Len() {
+				xi = x.Index(i)
+			}
+			if i < y.Len() {
+				yi = y.Index(i)
+			}
+			d.diff(fmt.Sprintf("%s[%d]", path, i), xi, yi)
+		}
+
+	case reflect.Struct:
+		for i, n := 0, x.NumField(); i < n; i++ {
+			f := x.Type().Field(i)
+			if d.opts.IgnoreUnexported && f.PkgPath != "" {
+				continue
+			}
+			d.diff(path+"."+f.Name, x.Field(i), y.Field(i))
+		}
+
+	case reflect.Map:
+		if !d.opts.NilEqualsEmpty && x.IsNil() != y.IsNil() {
+			d.report(path, x, y)
+			return
+		}
+		// Visit the keys of both maps in order of their formatting.
+		keys := x.MapKeys()
+		for _, k := range y.MapKeys() {
+			if !x.MapIndex(k).IsValid() {
+				keys = append(keys, k)
+			}
+		}
+		paths := make([]string, len(keys))
+		for i, k := range keys {
+			paths[i] = fmt.Sprintf("%s[%s]", path, format(k))
+		}
+		sort.Sort(byPath{paths, keys})
+		for i, k := range keys {
+			d.diff(paths[i], x.MapIndex(k), y.MapIndex(k))
+		}
+	}
+}
+
+// floatEqual reports whether x and y are equal to within the tolerance.
+func (d *differ) floatEqual(x, y float64) bool {
+	if x == y {
+		return true
+	}
+	return math.Abs(x-y) <= d.opts.FloatTolerance*math.Max(math.Abs(x), math.Abs(y))
+}
+
+// byPath sorts map keys by their paths.
+type byPath struct {
+	paths []string
+	keys  []reflect.Value
+}
+
+func (b byPath) Len() int           { return len(b.paths) }
+func (b byPath) Less(i, j int) bool { return b.paths[i] < b.paths[j] }
+func (b byPath) Swap(i, j int) {
+	b.paths[i], b.paths[j] = b.paths[j], b.paths[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+// format formats a value in a Difference or a path.
+func format(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return "<missing>"
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map,
+		reflect.Ptr, reflect.Slice:
+		if v.IsNil() {
+			return "nil"
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
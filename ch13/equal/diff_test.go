@@ -0,0 +1,133 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package equal
+
+import (
+	"fmt"
+	"testing"
+)
+
+type film struct {
+	Title  string
+	Actors map[string][]string
+	Rating float64
+	notes  string
+	Sequel *film
+}
+
+func Example_diff() {
+	x := film{
+		Title:  "Star Wars",
+		Actors: map[string][]string{"Han": {"pilot", "smuggler", "rogue"}, "Luke": {"farmer"}},
+		Rating: 8.6,
+	}
+	y := film{
+		Title:  "Star Wars",
+		Actors: map[string][]string{"Han": {"pilot", "smuggler", "general", "father"}, "Leia": {"princess"}},
+		Rating: 8.6,
+		Sequel: &film{Title: "The Empire Strikes Back"},
+	}
+	for _, d := range Diff(x, y) {
+		fmt.Println(d)
+	}
+	// Output:
+	// x.Actors["Han"][2]: "rogue" != "general"
+	// x.Actors["Han"][3]: <missing> != "father"
+	// x.Actors["Leia"]: <missing> != [princess]
+	// x.Actors["Luke"]: [farmer] != <missing>
+	// x.Sequel: nil != &{The Empire Strikes Back map[] 0  <nil>}
+}
+
+func TestDiffOptions(t *testing.T) {
+	x := film{Rating: 8.6, notes: "first cut", Actors: map[string][]string{}}
+	y := film{Rating: 8.6000001, notes: "final cut"}
+	for _, test := range []struct {
+		opts Options
+		want []string
+	}{
+		{Options{}, []string{
+			`x.Actors: map[] != nil`,
+			`x.Rating: 8.6 != 8.6000001`,
+			`x.notes: "first cut" != "final cut"`,
+		}},
+		{Options{NilEqualsEmpty: true, FloatTolerance: 1e-6}, []string{
+			`x.notes: "first cut" != "final cut"`,
+		}},
+		{Options{NilEqualsEmpty: true, IgnoreUnexported: true, FloatTolerance: 1e-9}, []string{
+			`x.Rating: 8.6 != 8.6000001`,
+		}},
+	} {
+		var got []string
+		for _, d := range test.opts.Diff(x, y) {
+			got = append(got, d.String())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%+v.Diff = %q, want %q", test.opts, got, test.want)
+		}
+	}
+}
+
+func TestDiffArrays(t *testing.T) {
+	x := struct{ A [2]int }{[2]int{1, 2}}
+	y := struct{ A [2]int }{[2]int{1, 3}}
+	for _, opts := range []Options{{}, {IgnoreUnexported: true}, {NilEqualsEmpty: true}} {
+		var got []string
+		for _, d := range opts.Diff(x, y) {
+			got = append(got, d.String())
+		}
+		if want := []string{"x.A[1]: 2 != 3"}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%+v.Diff = %q, want %q", opts, got, want)
+		}
+		if d := opts.Diff([2]int{1, 2}, [2]int{1, 2}); len(d) != 0 {
+			t.Errorf("%+v.Diff of equal arrays = %q", opts, d)
+		}
+	}
+}
+
+// TestDiffEqual checks that Diff reports no differences exactly
+// when Equal reports equality, including for cyclic values.
+func TestDiffEqual(t *testing.T) {
+	type link struct {
+		value string
+		tail  *link
+	}
+	a, b, c := &link{value: "a"}, &link{value: "b"}, &link{value: "c"}
+	a.tail, b.tail, c.tail = b, a, c
+	c2 := &link{value: "c"}
+	c2.tail = c2
+
+	type CycleSlice []CycleSlice
+	var cycleSlice = make(CycleSlice, 1)
+	cycleSlice[0] = cycleSlice
+
+	one, two := 1, 2
+	for _, test := range []struct {
+		x, y interface{}
+		want int // number of differences
+	}{
+		{1, 1, 0},
+		{1, 1.0, 1},
+		{nil, nil, 0},
+		{nil, 1, 1},
+		{[]string{}, []string(nil), 0},
+		{[]int{1, 2}, []int{1, 3, 4}, 2},
+		{[...]int{1, 2, 3}, [...]int{1, 2, 4}, 1},
+		{map[int]int{1: 1}, map[int]int{2: 1}, 2},
+		{&one, &two, 1},
+		{cycleSlice, cycleSlice, 0},
+		{a, a, 0},
+		{c, c2, 0},
+		{a, b, 2}, // a.value, b.value
+		{a, c, 2}, // a.value, then b.value; (a, c) is then seen
+		{(func())(nil), func() {}, 1},
+	} {
+		diffs := Diff(test.x, test.y)
+		if len(diffs) != test.want {
+			t.Errorf("Diff(%v, %v) = %v, want %d differences", test.x, test.y, diffs, test.want)
+		}
+		if eq := Equal(test.x, test.y); eq != (len(diffs) == 0) {
+			t.Errorf("Equal(%v, %v) = %t, but Diff = %v", test.x, test.y, eq, diffs)
+		}
+	}
+}
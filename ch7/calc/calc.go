@@ -0,0 +1,285 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Calc is an HTTP calculator service built on gopl.io/ch7/eval.
+//
+//	POST /eval        {"expr": "x > 10 ? a : b", "env": {"x": 12, "a": 1, "b": 2}}
+//	GET  /plot?expr=  an SVG surface plot of a function of x, y and r
+//
+// /eval responds with {"value": 1, "text": "1"}, or, if the
+// expression is erroneous, with status 400 and a list of errors
+// such as {"errors": [{"start": {"line": 1, "column": 3},
+// "end": {"line": 1, "column": 4}, "msg": "unexpected '%'"}]}.
+//
+// A plot evaluates the function at tens of thousands of points, so
+// /plot refuses expressions that compile to too many instructions,
+// and stops work on a plot when its request times out.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gopl.io/ch7/eval"
+)
+
+var (
+	addr       = flag.String("addr", "localhost:8000", "listen address")
+	maxExprLen = flag.Int("maxlen", 1000, "maximum length of an expression, in bytes")
+	timeout    = flag.Duration("timeout", 5*time.Second, "maximum time to handle a request")
+	maxWork    = flag.Int("maxwork", 1e8, "maximum number of instructions executed for a plot")
+)
+
+func main() {
+	flag.Parse()
+	s := &server{maxExprLen: *maxExprLen, timeout: *timeout, maxPlotWork: *maxWork}
+	log.Fatal(http.ListenAndServe(*addr, s.handler()))
+}
+
+// A server holds the limits on the requests it handles.
+type server struct {
+	maxExprLen  int           // maximum length of an expression, in bytes
+	timeout     time.Duration // maximum time to handle a request
+	maxPlotWork int           // if positive, maximum instructions executed for a plot
+}
+
+// handler returns the HTTP handler for the service.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/eval", s.eval)
+	mux.HandleFunc("/plot", s.plot)
+	return http.TimeoutHandler(mux, s.timeout, "request timed out\n")
+}
+
+// -- /eval --
+
+type evalRequest struct {
+	Expr string             `json:"expr"`
+	Env  map[string]float64 `json:"env"`
+}
+
+type evalResponse struct {
+	Value  *float64    `json:"value,omitempty"` // omitted if not finite
+	Text   string      `json:"text,omitempty"`  // the value, formatted with %g
+	Errors []errorJSON `json:"errors,omitempty"`
+}
+
+type errorJSON struct {
+	Start *posJSON `json:"start,omitempty"`
+	End   *posJSON `json:"end,omitempty"`
+	Msg   string   `json:"msg"`
+}
+
+type posJSON struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (s *server) eval(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body evalRequest
+	// Allow room for the bindings as well as the expression.
+	r := http.MaxBytesReader(w, req.Body, int64(s.maxExprLen)+1<<16)
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	env := make(eval.Env)
+	for name, x := range body.Env {
+		env[eval.Var(name)] = x
+	}
+	prog, err := s.compile(body.Expr, func(v eval.Var) bool {
+		_, ok := env[v]
+		return ok
+	})
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, evalResponse{Errors: errorsJSON(err)})
+		return
+	}
+	x := prog.Run(prog.Slots(env))
+	resp := evalResponse{Text: strconv.FormatFloat(x, 'g', -1, 64)}
+	if !math.IsNaN(x) && !math.IsInf(x, 0) {
+		resp.Value = &x
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// compile parses, checks and compiles the expression input,
+// which may use only the variables for which defined is true.
+// Compiled programs cannot recurse, so evaluating them
+// always terminates.
+func (s *server) compile(input string, defined func(eval.Var) bool) (*eval.Program, error) {
+	if input == "" {
+		var errs eval.ErrorList
+		start := eval.Pos{Line: 1, Column: 1}
+		errs.Add(eval.Span{Start: start, End: start}, "empty expression")
+		return nil, errs.Err()
+	}
+	if len(input) > s.maxExprLen {
+		return nil, fmt.Errorf("expression longer than %d bytes", s.maxExprLen)
+	}
+	src, err := eval.ParseSource(input)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[eval.Var]bool)
+	if err := src.Check(vars); err != nil {
+		return nil, err
+	}
+	var errs eval.ErrorList
+	for v := range vars {
+		if defined(v) {
+			continue
+		}
+		refs := src.Refs(v)
+		if refs == nil {
+			refs = []eval.Span{{}} // used by a function, position unknown
+		}
+		for _, span := range refs {
+			errs.Add(span, fmt.Sprintf("undefined variable: %s", v))
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return eval.Compile(src.Expr)
+}
+
+// errorsJSON returns the JSON form of err, with positions if known.
+func errorsJSON(err error) []errorJSON {
+	list, ok := err.(eval.ErrorList)
+	if !ok {
+		return []errorJSON{{Msg: err.Error()}}
+	}
+	var errs []errorJSON
+	for _, e := range list {
+		ej := errorJSON{Msg: e.Msg}
+		if e.Start.Line > 0 {
+			ej.Start = &posJSON{e.Start.Line, e.Start.Column}
+			ej.End = &posJSON{e.End.Line, e.End.Column}
+		}
+		errs = append(errs, ej)
+	}
+	return errs
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("writing response: %v", err)
+	}
+}
+
+// -- /plot --
+
+func (s *server) plot(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	prog, err := s.compile(req.URL.Query().Get("expr"), func(v eval.Var) bool {
+		return v == "x" || v == "y" || v == "r"
+	})
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, evalResponse{Errors: errorsJSON(err)})
+		return
+	}
+	if s.maxPlotWork > 0 && prog.Len() > s.maxPlotWork/points {
+		err := fmt.Errorf("expression too complex to plot: %d instructions, at most %d allowed",
+			prog.Len(), s.maxPlotWork/points)
+		writeJSON(w, http.StatusBadRequest, evalResponse{Errors: errorsJSON(err)})
+		return
+	}
+	vars := prog.Vars()
+	slots := make([]float64, len(vars))
+	w.Header().Set("Content-Type", "image/svg+xml")
+	// If the request times out, its response is abandoned; stop work on it.
+	surface(req.Context(), w, func(x, y float64) float64 {
+		for i, v := range vars {
+			switch v {
+			case "x":
+				slots[i] = x
+			case "y":
+				slots[i] = y
+			case "r":
+				slots[i] = math.Hypot(x, y) // distance from (0,0)
+			}
+		}
+		return prog.Run(slots)
+	})
+}
+
+// -- copied from gopl.io/ch7/surface --
+
+const (
+	width, height = 600, 320            // canvas size in pixels
+	cells         = 100                 // number of grid cells
+	xyrange       = 30.0                // x, y axis range (-xyrange..+xyrange)
+	xyscale       = width / 2 / xyrange // pixels per x or y unit
+	zscale        = height * 0.4        // pixels per z unit
+	points        = 4 * cells * cells   // number of calls of f by surface
+)
+
+var sin30, cos30 = 0.5, math.Sqrt(3.0 / 4.0) // sin(30°), cos(30°)
+
+func corner(f func(x, y float64) float64, i, j int) (float64, float64) {
+	// find point (x,y) at corner of cell (i,j)
+	x := xyrange * (float64(i)/cells - 0.5)
+	y := xyrange * (float64(j)/cells - 0.5)
+
+	z := f(x, y) // compute surface height z
+
+	// project (x,y,z) isometrically onto 2-D SVG canvas (sx,sy)
+	sx := width/2 + (x-y)*cos30*xyscale
+	sy := height/2 + (x+y)*sin30*xyscale - z*zscale
+	return sx, sy
+}
+
+// surface writes the SVG plot of f to w.  It returns early,
+// with an incomplete plot, if ctx is cancelled.
+func surface(ctx context.Context, w io.Writer, f func(x, y float64) float64) {
+	fmt.Fprintf(w, "<svg xmlns='http://www.w3.org/2000/svg' "+
+		"style='stroke: grey; fill: white; stroke-width: 0.7' "+
+		"width='%d' height='%d'>", width, height)
+	for i := 0; i < cells; i++ {
+		if ctx.Err() != nil {
+			return
+		}
+		for j := 0; j < cells; j++ {
+			ax, ay := corner(f, i+1, j)
+			bx, by := corner(f, i, j)
+			cx, cy := corner(f, i, j+1)
+			dx, dy := corner(f, i+1, j+1)
+			if !finite(ay, by, cy, dy) {
+				continue // skip cells where f is undefined, e.g., 1/r at 0
+			}
+			fmt.Fprintf(w, "<polygon points='%g,%g %g,%g %g,%g %g,%g'/>\n",
+				ax, ay, bx, by, cx, cy, dx, dy)
+		}
+	}
+	fmt.Fprintln(w, "</svg>")
+}
+
+// finite reports whether all of its arguments are finite.
+func finite(xs ...float64) bool {
+	for _, x := range xs {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,182 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer() *httptest.Server {
+	s := &server{maxExprLen: 100, timeout: 5 * time.Second}
+	return httptest.NewServer(s.handler())
+}
+
+func TestEval(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	for _, test := range []struct {
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{`{"expr": "x > 10 ? a : b", "env": {"x": 12, "a": 1, "b": 2}}`,
+			200, `{"value":1,"text":"1"}`},
+		{`{"expr": "sqrt(A)", "env": {"A": 87616}}`,
+			200, `{"value":296,"text":"296"}`},
+		{`{"expr": "1 / x", "env": {"x": 0}}`,
+			200, `{"text":"+Inf"}`},
+		{`{"expr": "x % 2 + y % 3", "env": {"x": 1, "y": 2}}`,
+			400, `{"errors":[` +
+				`{"start":{"line":1,"column":3},"end":{"line":1,"column":4},"msg":"unexpected '%'"},` +
+				`{"start":{"line":1,"column":11},"end":{"line":1,"column":12},"msg":"unexpected '%'"}]}`},
+		{`{"expr": "log(x)", "env": {"x": 1}}`,
+			400, `{"errors":[{"start":{"line":1,"column":1},"end":{"line":1,"column":7},"msg":"unknown function \"log\""}]}`},
+		{`{"expr": "x + y", "env": {"x": 1}}`,
+			400, `{"errors":[{"start":{"line":1,"column":5},"end":{"line":1,"column":6},"msg":"undefined variable: y"}]}`},
+		{`{"expr": "f(a) = a * y; f(x) + y", "env": {"x": 1}}`,
+			400, `{"errors":[` +
+				`{"start":{"line":1,"column":12},"end":{"line":1,"column":13},"msg":"undefined variable: y"},` +
+				`{"start":{"line":1,"column":22},"end":{"line":1,"column":23},"msg":"undefined variable: y"}]}`},
+		{`{"expr": "fact(n) = n <= 1 ? 1 : n * fact(n-1); fact(3)"}`,
+			400, `{"errors":[{"msg":"cannot compile recursive function fact"}]}`},
+		{`{"expr": "` + strings.Repeat("x+", 50) + `x", "env": {"x": 1}}`,
+			400, `{"errors":[{"msg":"expression longer than 100 bytes"}]}`},
+		{`{"expr": ""}`,
+			400, `{"errors":[{"start":{"line":1,"column":1},"end":{"line":1,"column":1},"msg":"empty expression"}]}`},
+		{`{"expr": `,
+			400, `bad request: unexpected EOF`},
+	} {
+		resp, err := http.Post(ts.URL+"/eval", "application/json", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.wantStatus {
+			t.Errorf("POST /eval %s: status %d, want %d", test.body, resp.StatusCode, test.wantStatus)
+		}
+		if got := strings.TrimSpace(string(body)); got != test.wantBody {
+			t.Errorf("POST /eval %s:\ngot  %s\nwant %s", test.body, got, test.wantBody)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/eval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /eval: status %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestPlot(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	get := func(expr string) (*http.Response, string) {
+		resp, err := http.Get(ts.URL + "/plot?expr=" + url.QueryEscape(expr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	resp, body := get("sin(-x)*pow(1.5,-r)")
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET /plot: status %d: %s", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("GET /plot: Content-Type %q, want image/svg+xml", ct)
+	}
+	if n := strings.Count(body, "<polygon "); !strings.HasPrefix(body, "<svg ") || n != cells*cells {
+		t.Errorf("GET /plot: got %d polygons, want %d", n, cells*cells)
+	}
+
+	// Cells where the function is undefined are omitted.
+	if _, body := get("1 / (x * y)"); strings.Contains(body, "NaN") || strings.Contains(body, "Inf") {
+		t.Errorf("GET /plot of 1 / (x * y) contains non-finite coordinates")
+	}
+
+	resp, body = get("z + 1")
+	if want := `{"errors":[{"start":{"line":1,"column":1},"end":{"line":1,"column":2},"msg":"undefined variable: z"}]}`; resp.StatusCode != 400 || strings.TrimSpace(body) != want {
+		t.Errorf("GET /plot of z + 1: status %d, body %s; want 400, %s", resp.StatusCode, body, want)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	s := &server{maxExprLen: 1000, timeout: time.Nanosecond}
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/plot?expr=" + url.QueryEscape("sin(r)/r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("GET /plot with 1ns timeout: status %d, want %d",
+			resp.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+// costly is an expression of nested inlined functions that compiles
+// to thousands of instructions.
+const costly = "a(x) = x + x + x + x; b(x) = a(a(a(a(x)))); c(x) = b(b(b(b(x)))); " +
+	"d(x) = c(c(c(c(x)))); e(x) = d(d(d(d(x)))); e(sin(r))"
+
+func TestPlotWork(t *testing.T) {
+	s := &server{maxExprLen: 1000, timeout: 5 * time.Second, maxPlotWork: 1e6}
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/plot?expr=" + url.QueryEscape(costly))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 400 || !strings.Contains(string(body), "too complex to plot") {
+		t.Errorf("GET /plot of costly expression: status %d, body %s; want 400", resp.StatusCode, body)
+	}
+}
+
+// TestPlotCancel checks that a plot stops when its request is done,
+// as when it times out, rather than evaluating every point.
+func TestPlotCancel(t *testing.T) {
+	s := &server{maxExprLen: 1000}
+	req := httptest.NewRequest("GET", "/plot?expr="+url.QueryEscape(costly), nil)
+	ctx, cancel := context.WithTimeout(req.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	s.plot(rec, req.WithContext(ctx))
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("plot took %v after its request timed out", d)
+	}
+	body := rec.Body.String()
+	if n := strings.Count(body, "<polygon "); n == cells*cells || strings.Contains(body, "</svg>") {
+		t.Errorf("plot drew %d of %d cells after its request timed out", n, cells*cells)
+	}
+}
@@ -3,6 +3,8 @@
 
 package eval
 
+import "fmt"
+
 // An Expr is an arithmetic expression.
 type Expr interface {
 	// Eval returns the value of this Expr in the environment env.
@@ -21,20 +23,51 @@ type literal float64
 
 // A unary represents a unary operator expression, e.g., -x.
 type unary struct {
-	op rune // one of '+', '-'
+	op string // one of "+", "-", "!"
 	x  Expr
 }
 
 // A binary represents a binary operator expression, e.g., x+y.
 type binary struct {
-	op   rune // one of '+', '-', '*', '/'
+	op   string // one of "+", "-", "*", "/", "<", "<=", ">", ">=", "==", "!=", "&&", "||"
 	x, y Expr
 }
 
 // A call represents a function call expression, e.g., sin(x).
 type call struct {
-	fn   string // one of "pow", "sin", "sqrt"
+	fn   string // e.g., "pow", "sin", "sqrt"
 	args []Expr
+	f    *Func // the function named fn, unless it is one of the Builtins
 }
 
 //!-ast
+
+// A conditional represents a conditional expression, e.g., x > 0 ? x : -x.
+type conditional struct {
+	cond, x, y Expr
+}
+
+// A Pos is a position in the text of an expression.
+// Lines and columns are numbered from 1.
+type Pos struct {
+	Line, Column int
+}
+
+func (p Pos) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Column) }
+
+// A Span is the range of text from which an Expr was parsed.
+// End is the position just after the last character.
+type Span struct {
+	Start, End Pos
+}
+
+// A spanTree records the spans of text from which the parts of an
+// expression were parsed.  It has the shape of the expression: kids
+// holds the spanTrees of its operands, in the order of their fields,
+// that is, x; x and y; cond, x and y; or args.  The spans are kept
+// apart from the Expr so that its values stay as simple as those
+// shown in Section 7.9.
+type spanTree struct {
+	Span
+	kids []*spanTree
+}
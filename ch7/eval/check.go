@@ -3,10 +3,7 @@
 
 package eval
 
-import (
-	"fmt"
-	"strings"
-)
+import "fmt"
 
 //!+Check
 
@@ -20,39 +17,111 @@ func (literal) Check(vars map[Var]bool) error {
 }
 
 func (u unary) Check(vars map[Var]bool) error {
-	if !strings.ContainsRune("+-", u.op) {
-		return fmt.Errorf("unexpected unary op %q", u.op)
+	var errs ErrorList
+	errs.mergeAt(0, u.x.Check(vars))
+	switch u.op {
+	case "+", "-", "!":
+		errs.merge(checkOperand(u.op, u.x, 0, u.op == "!"))
+	default:
+		errs.addAt(fmt.Sprintf("unexpected unary op %q", u.op))
 	}
-	return u.x.Check(vars)
+	return errs.Err()
 }
 
 func (b binary) Check(vars map[Var]bool) error {
-	if !strings.ContainsRune("+-*/", b.op) {
-		return fmt.Errorf("unexpected binary op %q", b.op)
+	var errs ErrorList
+	errs.mergeAt(0, b.x.Check(vars))
+	errs.mergeAt(1, b.y.Check(vars))
+	var logical bool
+	switch b.op {
+	case "+", "-", "*", "/", "<", "<=", ">", ">=":
+		logical = false
+	case "&&", "||":
+		logical = true
+	case "==", "!=":
+		// Both operands must have the same type, either one.
+		logical = isBool(b.x)
+	default:
+		errs.addAt(fmt.Sprintf("unexpected binary op %q", b.op))
+		return errs.Err()
 	}
-	if err := b.x.Check(vars); err != nil {
-		return err
-	}
-	return b.y.Check(vars)
+	errs.merge(checkOperand(b.op, b.x, 0, logical))
+	errs.merge(checkOperand(b.op, b.y, 1, logical))
+	return errs.Err()
 }
 
 func (c call) Check(vars map[Var]bool) error {
-	arity, ok := numParams[c.fn]
-	if !ok {
-		return fmt.Errorf("unknown function %q", c.fn)
-	}
-	if len(c.args) != arity {
-		return fmt.Errorf("call to %s has %d args, want %d",
-			c.fn, len(c.args), arity)
+	var errs ErrorList
+	for i, arg := range c.args {
+		errs.mergeAt(i, arg.Check(vars))
+		if isBool(arg) {
+			errs.addAt(fmt.Sprintf("boolean argument %s in call to %s",
+				Format(arg), c.fn), i)
+		}
 	}
-	for _, arg := range c.args {
-		if err := arg.Check(vars); err != nil {
-			return err
+	f := c.fun()
+	switch {
+	case f == nil:
+		errs.addAt(fmt.Sprintf("unknown function %q", c.fn))
+	case f.Variadic && len(c.args) < f.Arity:
+		errs.addAt(fmt.Sprintf("call to %s has %d args, want at least %d",
+			c.fn, len(c.args), f.Arity))
+	case !f.Variadic && len(c.args) != f.Arity:
+		errs.addAt(fmt.Sprintf("call to %s has %d args, want %d",
+			c.fn, len(c.args), f.Arity))
+	default:
+		for v := range f.free {
+			vars[v] = true
 		}
+		errs.merge(f.err)
 	}
-	return nil
+	return errs.Err()
 }
 
-var numParams = map[string]int{"pow": 2, "sin": 1, "sqrt": 1}
-
 //!-Check
+
+func (c conditional) Check(vars map[Var]bool) error {
+	var errs ErrorList
+	for i, e := range []Expr{c.cond, c.x, c.y} {
+		errs.mergeAt(i, e.Check(vars))
+	}
+	if !isBool(c.cond) {
+		errs.addAt(fmt.Sprintf("non-boolean condition %s in ?:",
+			Format(c.cond)), 0)
+	}
+	if isBool(c.x) != isBool(c.y) {
+		errs.addAt(fmt.Sprintf("mismatched operands %s and %s of ?:",
+			Format(c.x), Format(c.y)))
+	}
+	return errs.Err()
+}
+
+// isBool reports whether e yields a truth value
+// rather than a number.
+func isBool(e Expr) bool {
+	switch e := e.(type) {
+	case unary:
+		return e.op == "!"
+	case binary:
+		switch e.op {
+		case "<", "<=", ">", ">=", "==", "!=", "&&", "||":
+			return true
+		}
+	case conditional:
+		return isBool(e.x)
+	}
+	return false
+}
+
+// checkOperand reports an error if the operand x, the ith of
+// operator op, is not boolean when logical is set, or is boolean
+// when it is not.
+func checkOperand(op string, x Expr, i int, logical bool) error {
+	if isBool(x) == logical {
+		return nil
+	}
+	if logical {
+		return errorAt(fmt.Sprintf("non-boolean operand %s of %s", Format(x), op), i)
+	}
+	return errorAt(fmt.Sprintf("boolean operand %s of %s", Format(x), op), i)
+}
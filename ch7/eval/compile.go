@@ -0,0 +1,356 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A Program is an Expr compiled to instructions for a stack machine.
+// It is much faster than Eval for expressions evaluated many times.
+//
+// Variables are held in numbered slots instead of an Env;
+// Vars reports which variable each slot holds.
+type Program struct {
+	code   []instr
+	consts []float64
+	funcs  []*Func // functions called by opCall
+	vars   []Var   // variable of each slot
+	depth  int     // maximum stack depth
+	locals int     // number of locals, for parameters of inlined functions
+	argc   int     // maximum number of arguments of opCall
+}
+
+// An instr is a single stack machine instruction.
+type instr struct {
+	op   opcode
+	arg  int32 // constant, slot, local or function index, or jump target
+	argc int32 // number of arguments of opCall
+}
+
+type opcode uint8
+
+const (
+	opConst      opcode = iota // push consts[arg]
+	opLoad                     // push slots[arg]
+	opLoadLocal                // push locals[arg]
+	opStoreLocal               // x => ; locals[arg] = x
+	opNeg                      // x => -x
+	opNot                      // x => !x
+	opAdd                      // x y => x+y
+	opSub
+	opMul
+	opDiv
+	opLT
+	opLE
+	opGT
+	opGE
+	opEQ
+	opNE
+	opPow
+	opSin
+	opSqrt
+	opCall        // x1 ... xn => funcs[arg](x1, ..., xn), where n = argc
+	opJump        // goto arg
+	opJumpIfFalse // x => ; goto arg if x == 0
+)
+
+var binaryOps = map[string]opcode{
+	"+": opAdd, "-": opSub, "*": opMul, "/": opDiv,
+	"<": opLT, "<=": opLE, ">": opGT, ">=": opGE, "==": opEQ, "!=": opNE,
+}
+
+type compilePanic string
+
+// Compile checks e and compiles it to a Program.
+// Calls to functions defined within the expression are expanded
+// inline, so Compile reports an error if such a function is recursive.
+func Compile(e Expr) (_ *Program, err error) {
+	defer func() {
+		switch x := recover().(type) {
+		case nil:
+			// no panic
+		case compilePanic:
+			err = fmt.Errorf("%s", x)
+		default:
+			// unexpected panic: resume state of panic.
+			panic(x)
+		}
+	}()
+	vars := make(map[Var]bool)
+	if err := e.Check(vars); err != nil {
+		return nil, err
+	}
+	c := &compiler{
+		p:         new(Program),
+		slots:     make(map[Var]int),
+		locals:    make(map[Var]int),
+		expanding: make(map[*Func]bool),
+	}
+	for v := range vars {
+		c.p.vars = append(c.p.vars, v)
+	}
+	sort.Slice(c.p.vars, func(i, j int) bool { return c.p.vars[i] < c.p.vars[j] })
+	for i, v := range c.p.vars {
+		c.slots[v] = i
+	}
+	c.expr(e)
+	return c.p, nil
+}
+
+// Vars returns the variable held in each slot, in slot order.
+func (p *Program) Vars() []Var { return append([]Var(nil), p.vars...) }
+
+// Len returns the number of instructions in the program.  Jumps are
+// only forward, so it bounds the instructions executed by each Run.
+func (p *Program) Len() int { return len(p.code) }
+
+// Slots returns the slot values corresponding to env.
+func (p *Program) Slots(env Env) []float64 {
+	slots := make([]float64, len(p.vars))
+	for i, v := range p.vars {
+		slots[i] = env[v]
+	}
+	return slots
+}
+
+// Run executes the program and returns the value of the expression.
+// slots[i] is the value of the variable p.Vars()[i].
+func (p *Program) Run(slots []float64) float64 {
+	if len(slots) < len(p.vars) {
+		panic(fmt.Sprintf("Run: got %d slots, want %d", len(slots), len(p.vars)))
+	}
+	var buf [32]float64
+	stack := buf[:]
+	if p.depth > len(buf) {
+		stack = make([]float64, p.depth)
+	}
+	var localsBuf [8]float64
+	locals := localsBuf[:]
+	if p.locals > len(localsBuf) {
+		locals = make([]float64, p.locals)
+	}
+	var args []float64 // arguments of opCall, allocated once if needed
+	sp := 0            // number of values on the stack
+	for pc := 0; pc < len(p.code); pc++ {
+		in := p.code[pc]
+		switch in.op {
+		case opConst:
+			stack[sp] = p.consts[in.arg]
+			sp++
+		case opLoad:
+			stack[sp] = slots[in.arg]
+			sp++
+		case opLoadLocal:
+			stack[sp] = locals[in.arg]
+			sp++
+		case opStoreLocal:
+			sp--
+			locals[in.arg] = stack[sp]
+		case opNeg:
+			stack[sp-1] = -stack[sp-1]
+		case opNot:
+			stack[sp-1] = truth(stack[sp-1] == 0)
+		case opSin:
+			stack[sp-1] = math.Sin(stack[sp-1])
+		case opSqrt:
+			stack[sp-1] = math.Sqrt(stack[sp-1])
+		case opCall:
+			if args == nil {
+				args = make([]float64, p.argc)
+			}
+			n := int(in.argc)
+			sp -= copy(args[:n], stack[sp-n:sp])
+			stack[sp] = p.funcs[in.arg].Fn(args[:n])
+			sp++
+		case opJump:
+			pc = int(in.arg) - 1
+		case opJumpIfFalse:
+			sp--
+			if stack[sp] == 0 {
+				pc = int(in.arg) - 1
+			}
+		default:
+			// binary operation
+			sp--
+			x, y := stack[sp-1], stack[sp]
+			var z float64
+			switch in.op {
+			case opAdd:
+				z = x + y
+			case opSub:
+				z = x - y
+			case opMul:
+				z = x * y
+			case opDiv:
+				z = x / y
+			case opLT:
+				z = truth(x < y)
+			case opLE:
+				z = truth(x <= y)
+			case opGT:
+				z = truth(x > y)
+			case opGE:
+				z = truth(x >= y)
+			case opEQ:
+				z = truth(x == y)
+			case opNE:
+				z = truth(x != y)
+			case opPow:
+				z = math.Pow(x, y)
+			default:
+				panic(fmt.Sprintf("unknown opcode %d", in.op))
+			}
+			stack[sp-1] = z
+		}
+	}
+	return stack[0]
+}
+
+// A compiler holds the state of a call to Compile.
+type compiler struct {
+	p         *Program
+	slots     map[Var]int
+	locals    map[Var]int    // local of each parameter of an expanded function
+	expanding map[*Func]bool // functions whose body is being expanded
+	sp        int            // current stack depth
+}
+
+// maxInstrs limits the size of a Program.  Without it, expanding
+// calls to functions that call other functions several times may
+// produce a program exponentially larger than the expression.
+const maxInstrs = 1 << 20
+
+// emit appends an instruction that changes
+// the stack depth by delta and returns its address.
+func (c *compiler) emit(op opcode, arg int, delta int) int {
+	if len(c.p.code) >= maxInstrs {
+		panic(compilePanic("expression too large to compile"))
+	}
+	c.p.code = append(c.p.code, instr{op: op, arg: int32(arg)})
+	c.sp += delta
+	if c.sp > c.p.depth {
+		c.p.depth = c.sp
+	}
+	return len(c.p.code) - 1
+}
+
+// patch sets the target of the jump at addr to the next instruction.
+func (c *compiler) patch(addr int) {
+	c.p.code[addr].arg = int32(len(c.p.code))
+}
+
+func (c *compiler) constant(x float64) {
+	c.emit(opConst, len(c.p.consts), +1)
+	c.p.consts = append(c.p.consts, x)
+}
+
+func (c *compiler) expr(e Expr) {
+	switch e := e.(type) {
+	case literal:
+		c.constant(float64(e))
+
+	case Var:
+		c.variable(e)
+
+	case unary:
+		c.expr(e.x)
+		switch e.op {
+		case "-":
+			c.emit(opNeg, 0, 0)
+		case "!":
+			c.emit(opNot, 0, 0)
+		}
+
+	case binary:
+		switch e.op {
+		case "&&", "||":
+			// Short-circuit evaluation:
+			//   x && y    =>    x; jf F; y; jf F; 1; jmp E; F: 0; E:
+			//   x || y    =>    x; not; jf T; y; not; jf T; 0; jmp E; T: 1; E:
+			var jumps []int
+			for _, operand := range []Expr{e.x, e.y} {
+				c.expr(operand)
+				if e.op == "||" {
+					c.emit(opNot, 0, 0)
+				}
+				jumps = append(jumps, c.emit(opJumpIfFalse, 0, -1))
+			}
+			c.constant(truth(e.op == "&&"))
+			end := c.emit(opJump, 0, 0)
+			for _, addr := range jumps {
+				c.patch(addr)
+			}
+			c.sp-- // only one of the two constants is pushed
+			c.constant(truth(e.op == "||"))
+			c.patch(end)
+		default:
+			c.expr(e.x)
+			c.expr(e.y)
+			c.emit(binaryOps[e.op], 0, -1)
+		}
+
+	case conditional:
+		c.expr(e.cond)
+		els := c.emit(opJumpIfFalse, 0, -1)
+		c.expr(e.x)
+		end := c.emit(opJump, 0, 0)
+		c.patch(els)
+		c.sp-- // only one of the two arms is pushed
+		c.expr(e.y)
+		c.patch(end)
+
+	case call:
+		for _, arg := range e.args {
+			c.expr(arg)
+		}
+		switch {
+		case e.isBuiltin("pow"):
+			c.emit(opPow, 0, -1)
+		case e.isBuiltin("sin"):
+			c.emit(opSin, 0, 0)
+		case e.isBuiltin("sqrt"):
+			c.emit(opSqrt, 0, 0)
+		case e.fun().body != nil:
+			c.expand(e.fn, e.f)
+		default:
+			c.emit(opCall, len(c.p.funcs), 1-len(e.args))
+			c.p.code[len(c.p.code)-1].argc = int32(len(e.args))
+			c.p.funcs = append(c.p.funcs, e.fun())
+			if len(e.args) > c.p.argc {
+				c.p.argc = len(e.args)
+			}
+		}
+
+	default:
+		panic(fmt.Sprintf("unknown Expr: %T", e))
+	}
+}
+
+// variable emits an instruction to push the value of v.
+func (c *compiler) variable(v Var) {
+	if local, ok := c.locals[v]; ok {
+		c.emit(opLoadLocal, local, +1)
+	} else {
+		c.emit(opLoad, c.slots[v], +1)
+	}
+}
+
+// expand emits the body of the function f, defined within
+// the expression, whose arguments are on top of the stack.
+func (c *compiler) expand(name string, f *Func) {
+	if c.expanding[f] {
+		panic(compilePanic(fmt.Sprintf("cannot compile recursive function %s", name)))
+	}
+	c.expanding[f] = true
+	for i := len(f.params) - 1; i >= 0; i-- {
+		c.locals[f.params[i]] = c.p.locals
+		c.emit(opStoreLocal, c.p.locals, -1)
+		c.p.locals++
+	}
+	c.expr(f.body)
+	delete(c.expanding, f)
+}
@@ -0,0 +1,128 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	for _, test := range evalTests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		prog, err := Compile(expr)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", test.expr, err)
+			continue
+		}
+		want := expr.Eval(test.env)
+		got := prog.Run(prog.Slots(test.env))
+		if got != want && !(math.IsNaN(got) && math.IsNaN(want)) {
+			t.Errorf("%s: Run() in %v = %g, Eval() = %g",
+				test.expr, test.env, got, want)
+		}
+		if s := fmt.Sprintf("%.6g", got); s != test.want {
+			t.Errorf("%s: Run() in %v = %q, want %q",
+				test.expr, test.env, s, test.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	expr, err := Parse("sqrt(1, 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Compile(expr); err == nil {
+		t.Errorf("Compile(sqrt(1, 2)) succeeded, want error")
+	}
+}
+
+func TestProgramVars(t *testing.T) {
+	expr, err := Parse("y * x + y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := Compile(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(prog.Vars()); got != "[x y]" {
+		t.Errorf("Vars() = %s, want [x y]", got)
+	}
+	if got := prog.Run([]float64{2, 3}); got != 9 {
+		t.Errorf("Run([2 3]) = %g, want 9", got)
+	}
+}
+
+// surfaceExpr is a typical expression plotted by gopl.io/ch7/surface.
+const surfaceExpr = "r > 0 ? sin(r) / r : 1"
+
+func BenchmarkEval(b *testing.B) {
+	expr, err := Parse(surfaceExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	env := Env{"r": 1.5}
+	for i := 0; i < b.N; i++ {
+		expr.Eval(env)
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	expr, err := Parse(surfaceExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	prog, err := Compile(expr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	slots := []float64{1.5}
+	for i := 0; i < b.N; i++ {
+		prog.Run(slots)
+	}
+}
+
+// TestRunAllocs checks that calls of Registry functions do not
+// allocate their arguments afresh.
+func TestRunAllocs(t *testing.T) {
+	expr, err := mathFuncs.Parse("min(x, 1, 2) + max(x, 3) + cos(x) + log(x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := Compile(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slots := []float64{1.5}
+	if n := testing.AllocsPerRun(100, func() { prog.Run(slots) }); n > 1 {
+		t.Errorf("Run of 4 calls made %g allocations, want at most 1", n)
+	}
+	if got, want := prog.Run(slots), 1+3+math.Cos(1.5)+math.Log(1.5); got != want {
+		t.Errorf("Run = %g, want %g", got, want)
+	}
+}
+
+func TestCompileTooLarge(t *testing.T) {
+	// Each function doubles the size of the expanded code.
+	input := "f0(x) = x + x; "
+	for i := 1; i <= 24; i++ {
+		input += fmt.Sprintf("f%d(x) = f%d(f%d(x)); ", i, i-1, i-1)
+	}
+	input += "f24(1)"
+	expr, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Compile(expr)
+	if want := "expression too large to compile"; err == nil || err.Error() != want {
+		t.Errorf("Compile: got error %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import "fmt"
+
+// A ComplexEnv maps variables to complex values.
+type ComplexEnv map[Var]complex128
+
+// EvalComplex returns the value of e when its variables
+// take the complex values of env.
+//
+// Comparisons and logical operators yield 1 or 0, and conditions
+// are true if nonzero.  The ordered comparisons (< <= > >=) panic
+// unless both operands are real.  EvalComplex panics if e calls
+// a function without a Complex implementation.
+func EvalComplex(e Expr, env ComplexEnv) complex128 {
+	switch e := e.(type) {
+	case literal:
+		return complex(float64(e), 0)
+
+	case Var:
+		return env[e]
+
+	case unary:
+		x := EvalComplex(e.x, env)
+		switch e.op {
+		case "+":
+			return x
+		case "-":
+			return -x
+		case "!":
+			return complexTruth(x == 0)
+		}
+		panic(fmt.Sprintf("unsupported unary operator: %q", e.op))
+
+	case binary:
+		switch e.op {
+		case "&&":
+			return complexTruth(EvalComplex(e.x, env) != 0 && EvalComplex(e.y, env) != 0)
+		case "||":
+			return complexTruth(EvalComplex(e.x, env) != 0 || EvalComplex(e.y, env) != 0)
+		}
+		x := EvalComplex(e.x, env)
+		y := EvalComplex(e.y, env)
+		switch e.op {
+		case "+":
+			return x + y
+		case "-":
+			return x - y
+		case "*":
+			return x * y
+		case "/":
+			return x / y
+		case "==":
+			return complexTruth(x == y)
+		case "!=":
+			return complexTruth(x != y)
+		}
+		if imag(x) != 0 || imag(y) != 0 {
+			panic(fmt.Sprintf("comparison of non-real values: %v %s %v", x, e.op, y))
+		}
+		switch e.op {
+		case "<":
+			return complexTruth(real(x) < real(y))
+		case "<=":
+			return complexTruth(real(x) <= real(y))
+		case ">":
+			return complexTruth(real(x) > real(y))
+		case ">=":
+			return complexTruth(real(x) >= real(y))
+		}
+		panic(fmt.Sprintf("unsupported binary operator: %q", e.op))
+
+	case conditional:
+		if EvalComplex(e.cond, env) != 0 {
+			return EvalComplex(e.x, env)
+		}
+		return EvalComplex(e.y, env)
+
+	case call:
+		f := e.fun()
+		args := make([]complex128, len(e.args))
+		for i, arg := range e.args {
+			args[i] = EvalComplex(arg, env)
+		}
+		if f != nil && f.body != nil {
+			local := make(ComplexEnv, len(env)+len(args)+1)
+			for v, x := range env {
+				local[v] = x
+			}
+			for i, param := range f.params {
+				local[param] = args[i]
+			}
+			local[depth] = complex(enter(real(env[depth])), 0)
+			return EvalComplex(f.body, local)
+		}
+		if f == nil || f.Complex == nil {
+			panic(fmt.Sprintf("unsupported function call: %s", e.fn))
+		}
+		return f.Complex(args)
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+func complexTruth(b bool) complex128 { return complex(truth(b), 0) }
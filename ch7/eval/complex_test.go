@@ -0,0 +1,71 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math/cmplx"
+	"testing"
+)
+
+func TestEvalComplex(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		env  ComplexEnv
+		want string
+	}{
+		{"sqrt(x)", ComplexEnv{"x": -4}, "(0+2i)"},
+		{"z * z + c", ComplexEnv{"z": 1i, "c": 0.5}, "(-0.5+0i)"},
+		{"pow(z, 2) + c", ComplexEnv{"z": 1 + 1i, "c": -1}, "(-1+2i)"},
+		{"1 / z", ComplexEnv{"z": 1i}, "(0-1i)"},
+		{"sin(z)", ComplexEnv{"z": 0}, "(0+0i)"},
+		{"z == w ? 1 : 2", ComplexEnv{"z": 1i, "w": 1i}, "(1+0i)"},
+		{"z != w ? 1 : 2", ComplexEnv{"z": 1i, "w": 1i}, "(2+0i)"},
+		{"x > 0 && !(y < 0)", ComplexEnv{"x": 1, "y": 1}, "(1+0i)"},
+		{"f(z) = z * z; f(f(z))", ComplexEnv{"z": 1 + 1i}, "(-4+0i)"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		got := fmt.Sprintf("%.6g", EvalComplex(expr, test.env))
+		if got != test.want {
+			t.Errorf("%s in %v = %s, want %s", test.expr, test.env, got, test.want)
+		}
+	}
+}
+
+// TestEvalComplexReal checks that EvalComplex agrees
+// with Eval on real values.
+func TestEvalComplexReal(t *testing.T) {
+	for _, test := range evalTests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		env := ComplexEnv{}
+		for v, x := range test.env {
+			env[v] = complex(x, 0)
+		}
+		want := expr.Eval(test.env)
+		if got := EvalComplex(expr, env); cmplx.Abs(got-complex(want, 0)) > 1e-9 {
+			t.Errorf("%s in %v = %g, want %g", test.expr, test.env, got, want)
+		}
+	}
+}
+
+func TestEvalComplexOrdered(t *testing.T) {
+	expr, err := Parse("z < 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("EvalComplex(z < 1) with non-real z did not panic")
+		}
+	}()
+	EvalComplex(expr, ComplexEnv{"z": 1i})
+}
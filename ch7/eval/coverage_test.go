@@ -17,7 +17,7 @@ func TestCoverage(t *testing.T) {
 		want  string // expected error from Parse/Check or result from Eval
 	}{
 		{"x % 2", nil, "unexpected '%'"},
-		{"!true", nil, "unexpected '!'"},
+		{"!true", nil, "non-boolean operand true of !"},
 		{"log(10)", nil, `unknown function "log"`},
 		{"sqrt(1, 2)", nil, "call to sqrt has 2 args, want 1"},
 		{"sqrt(A / pi)", Env{"A": 87616, "pi": math.Pi}, "167"},
@@ -0,0 +1,248 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+)
+
+// Derive returns the derivative of e with respect to v.
+// The result is not simplified; see Simplify.
+//
+// Comparison and logical operators are treated as piecewise
+// constant, so their derivative is zero.  A call of a function
+// defined in the expression is differentiated by substituting
+// its arguments into its body.  Derive panics if e calls a
+// function of a Registry other than the Builtins or a recursive
+// function, or is pow(x, y) where y depends on v, since the
+// derivative requires a logarithm.
+func Derive(e Expr, v Var) Expr {
+	switch e := e.(type) {
+	case literal:
+		return num(0)
+
+	case Var:
+		if e == v {
+			return num(1)
+		}
+		return num(0)
+
+	case unary:
+		if e.op == "!" {
+			return num(0)
+		}
+		return unary{op: e.op, x: Derive(e.x, v)}
+
+	case binary:
+		dx, dy := Derive(e.x, v), Derive(e.y, v)
+		switch e.op {
+		case "+", "-":
+			return bin(e.op, dx, dy)
+		case "*":
+			// (xy)' = x'y + xy'
+			return bin("+", bin("*", dx, e.y), bin("*", e.x, dy))
+		case "/":
+			// (x/y)' = (x'y - xy') / y²
+			return bin("/",
+				bin("-", bin("*", dx, e.y), bin("*", e.x, dy)),
+				bin("*", e.y, e.y))
+		}
+		return num(0)
+
+	case conditional:
+		return conditional{cond: e.cond, x: Derive(e.x, v), y: Derive(e.y, v)}
+
+	case call:
+		switch {
+		case e.f != nil && e.f.body != nil:
+			// The chain rule: f(g(x))' is the derivative of the
+			// body of f with g(x) in place of its parameter.
+			return Derive(inline(e, nil, make(map[*Func]bool)), v)
+		case e.isBuiltin("pow"):
+			x, y := e.args[0], e.args[1]
+			if !isConst(Simplify(Derive(y, v))) {
+				panic(fmt.Sprintf("Derive: exponent of %s depends on %s",
+					Format(e), v))
+			}
+			// pow(x, y)' = y * pow(x, y-1) * x'
+			return bin("*",
+				bin("*", y, builtin("pow", x, bin("-", y, num(1)))),
+				Derive(x, v))
+		case e.isBuiltin("sin"):
+			// sin(x)' = cos(x) * x' = sin(x + π/2) * x'
+			x := e.args[0]
+			return bin("*", builtin("sin", bin("+", x, num(math.Pi/2))), Derive(x, v))
+		case e.isBuiltin("sqrt"):
+			// sqrt(x)' = x' / (2 * sqrt(x))
+			return bin("/", Derive(e.args[0], v), bin("*", num(2), e))
+		}
+	}
+	panic(fmt.Sprintf("Derive: unsupported Expr: %s", Format(e)))
+}
+
+// inline returns e with the variables in args replaced by their
+// values and each call of a function defined in the expression
+// replaced by its body.  It panics if such a function is called,
+// directly or indirectly, from its own body, as the expansion
+// would never end.  expanding holds the functions being inlined.
+func inline(e Expr, args map[Var]Expr, expanding map[*Func]bool) Expr {
+	switch e := e.(type) {
+	case Var:
+		if x, ok := args[e]; ok {
+			return x
+		}
+	case unary:
+		return unary{e.op, inline(e.x, args, expanding)}
+	case binary:
+		return binary{e.op, inline(e.x, args, expanding), inline(e.y, args, expanding)}
+	case conditional:
+		return conditional{inline(e.cond, args, expanding),
+			inline(e.x, args, expanding), inline(e.y, args, expanding)}
+	case call:
+		xs := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			xs[i] = inline(arg, args, expanding)
+		}
+		f := e.f
+		if f == nil || f.body == nil {
+			return call{e.fn, xs, e.f}
+		}
+		if expanding[f] {
+			panic(fmt.Sprintf("Derive: recursive function %s", e.fn))
+		}
+		expanding[f] = true
+		params := make(map[Var]Expr, len(f.params))
+		for i, param := range f.params {
+			params[param] = xs[i]
+		}
+		body := inline(f.body, params, expanding)
+		delete(expanding, f)
+		return body
+	}
+	return e // literal, or a variable not in args
+}
+
+// Helpers for constructing expressions.
+func num(x float64) Expr                   { return literal(x) }
+func bin(op string, x, y Expr) Expr        { return binary{op: op, x: x, y: y} }
+func builtin(fn string, args ...Expr) Expr { return call{fn: fn, args: args} }
+
+// Simplify returns an expression equivalent to e but with constant
+// subexpressions folded and identities such as x*1, x+0 and 0*x
+// eliminated.  Like the algebra it is based on, it assumes all
+// values are finite: 0*x is simplified to 0 even though x may be NaN.
+// The expression must be free of errors reported by Check.
+func Simplify(e Expr) Expr {
+	switch e := e.(type) {
+	case unary:
+		x := Simplify(e.x)
+		switch e.op {
+		case "+":
+			return x
+		case "-":
+			if u, ok := x.(unary); ok && u.op == "-" {
+				return u.x // -(-x) = x
+			}
+		}
+		return fold(unary{e.op, x})
+
+	case binary:
+		x, y := Simplify(e.x), Simplify(e.y)
+		switch e.op {
+		case "+":
+			if isLiteral(x, 0) {
+				return y
+			}
+			if isLiteral(y, 0) {
+				return x
+			}
+		case "-":
+			if isLiteral(y, 0) {
+				return x
+			}
+			if isLiteral(x, 0) {
+				return Simplify(unary{"-", y})
+			}
+		case "*":
+			if isLiteral(x, 0) || isLiteral(y, 0) {
+				return num(0)
+			}
+			if isLiteral(x, 1) {
+				return y
+			}
+			if isLiteral(y, 1) {
+				return x
+			}
+		case "/":
+			if isLiteral(x, 0) {
+				return num(0)
+			}
+			if isLiteral(y, 1) {
+				return x
+			}
+		}
+		return fold(binary{e.op, x, y})
+
+	case conditional:
+		cond := Simplify(e.cond)
+		x, y := Simplify(e.x), Simplify(e.y)
+		if isConst(cond) {
+			if cond.Eval(nil) != 0 {
+				return x
+			}
+			return y
+		}
+		return conditional{cond, x, y}
+
+	case call:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			args[i] = Simplify(arg)
+		}
+		return fold(call{e.fn, args, e.f})
+	}
+	return e // literal or Var
+}
+
+// fold replaces e by its value if it is a numeric expression
+// whose operands are literals.  Boolean expressions are not
+// folded, as a literal cannot stand where a truth value is needed.
+func fold(e Expr) Expr {
+	if isConst(e) && !isBool(e) {
+		return literal(e.Eval(nil))
+	}
+	return e
+}
+
+// isConst reports whether e contains no variables.
+func isConst(e Expr) bool {
+	switch e := e.(type) {
+	case literal:
+		return true
+	case unary:
+		return isConst(e.x)
+	case binary:
+		return isConst(e.x) && isConst(e.y)
+	case conditional:
+		return isConst(e.cond) && isConst(e.x) && isConst(e.y)
+	case call:
+		if f := e.fun(); f == nil || f.body != nil {
+			return false // body may refer to variables
+		}
+		for _, arg := range e.args {
+			if !isConst(arg) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isLiteral reports whether e is the literal x.
+func isLiteral(e Expr, x float64) bool {
+	l, ok := e.(literal)
+	return ok && float64(l) == x
+}
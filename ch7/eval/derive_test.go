@@ -0,0 +1,138 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDerive(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		v    Var
+		want string // Format(Simplify(Derive(expr, v)))
+	}{
+		{"42", "x", "0"},
+		{"x", "x", "1"},
+		{"y", "x", "0"},
+		{"-x", "x", "-1"},
+		{"3 * x + 2", "x", "3"},
+		{"x * y", "x", "y"},
+		{"x * y", "y", "x"},
+		{"x * x", "x", "(x + x)"},
+		{"1 / x", "x", "(-1 / (x * x))"},
+		{"pow(x, 3)", "x", "(3 * pow(x, 2))"},
+		{"pow(y, 3)", "x", "0"},
+		{"sqrt(x)", "x", "(1 / (2 * sqrt(x)))"},
+		{"sin(2 * x)", "x", "(sin(((2 * x) + 1.5707963267948966)) * 2)"},
+		{"x > 0 ? x : -x", "x", "((x > 0) ? 1 : -1)"},
+		{"x > 0 && y > 0", "x", "0"},
+		{"f(x) = x * x; f(x)", "x", "(x + x)"},
+		{"f(x) = x * x; f(3 * x)", "x", "((3 * (3 * x)) + ((3 * x) * 3))"},
+		{"f(x) = x * x; f(y)", "x", "0"},
+		{"f(x) = a * x; g(y) = f(y) + y; g(x)", "x", "(a + 1)"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		if got := Format(Simplify(Derive(expr, test.v))); got != test.want {
+			t.Errorf("d/d%s %s = %s, want %s", test.v, test.expr, got, test.want)
+		}
+	}
+}
+
+// TestDeriveNumeric compares derivatives against finite differences.
+func TestDeriveNumeric(t *testing.T) {
+	for _, input := range []string{
+		"sqrt(A / pi)",
+		"pow(x, 3) + pow(y, 3)",
+		"5 / 9 * (F - 32)",
+		"sin(x * y) / (1 + x * x)",
+		"x < 1 ? pow(x, 2) : sqrt(x)",
+		"f(u, v) = u * sin(v); f(x, x * y) + f(y, 1)",
+	} {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		vars := make(map[Var]bool)
+		if err := expr.Check(vars); err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		env := Env{}
+		for v := range vars {
+			env[v] = 1.7
+		}
+		env["pi"] = math.Pi
+		for v := range vars {
+			d := Simplify(Derive(expr, v))
+			if err := d.Check(map[Var]bool{}); err != nil {
+				t.Errorf("d/d%s %s = %s: %v", v, input, Format(d), err)
+				continue
+			}
+			const h = 1e-6
+			x := env[v]
+			env[v] = x + h
+			hi := expr.Eval(env)
+			env[v] = x - h
+			lo := expr.Eval(env)
+			env[v] = x
+			want := (hi - lo) / (2 * h)
+			if got := d.Eval(env); math.Abs(got-want) > 1e-5*math.Max(1, math.Abs(want)) {
+				t.Errorf("d/d%s %s = %s = %g at %v, want %g",
+					v, input, Format(d), got, env, want)
+			}
+		}
+	}
+}
+
+func TestDeriveRecursive(t *testing.T) {
+	expr, err := Parse("fact(n) = n <= 1 ? 1 : n * fact(n - 1); fact(x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		want := "Derive: recursive function fact"
+		if got := recover(); got != want {
+			t.Errorf("Derive of recursive function: panic %v, want %q", got, want)
+		}
+	}()
+	Derive(expr, "x")
+}
+
+func TestSimplify(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"x * 1", "x"},
+		{"1 * x", "x"},
+		{"x + 0", "x"},
+		{"0 + x", "x"},
+		{"x - 0", "x"},
+		{"0 - x", "(-x)"},
+		{"0 * x", "0"},
+		{"x * 0", "0"},
+		{"x / 1", "x"},
+		{"--x", "x"},
+		{"+x", "x"},
+		{"2 * 3 + x", "(6 + x)"},
+		{"pow(2, 10) * y", "(1024 * y)"},
+		{"1 < 2 ? x : y", "x"},
+		{"1 > 2 ? x : y", "y"},
+		{"x < 2 * 3", "(x < 6)"},
+		{"1 < 2 && x > 0", "((1 < 2) && (x > 0))"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		if got := Format(Simplify(expr)); got != test.want {
+			t.Errorf("Simplify(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
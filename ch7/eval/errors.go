@@ -0,0 +1,143 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"sort"
+)
+
+// An Error is a problem found by Parse or Check, with the
+// span of the text responsible for it.
+type Error struct {
+	Span
+	Msg string
+
+	// at is the path from the checked Expr to the part of it
+	// responsible for the error, as indexes of operands, until
+	// the Span is found from the spanTree of the Expr.
+	at []int
+}
+
+// same reports whether e and f are the same error.
+func (e *Error) same(f *Error) bool {
+	if e.Span != f.Span || e.Msg != f.Msg || len(e.at) != len(f.at) {
+		return false
+	}
+	for i := range e.at {
+		if e.at[i] != f.at[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Error returns the message, without the position.
+func (e *Error) Error() string { return e.Msg }
+
+// An ErrorList is a list of errors, ordered by position.
+// Parse and Check report all the errors they find as an ErrorList.
+type ErrorList []*Error
+
+// Add appends an error with the given span and message to the list.
+func (l *ErrorList) Add(span Span, msg string) {
+	*l = append(*l, &Error{Span: span, Msg: msg})
+}
+
+// errorAt returns an error with the given message about the
+// part of an Expr at the path at, whose Span is not yet known.
+func errorAt(msg string, at ...int) *Error {
+	return &Error{Msg: msg, at: append([]int{}, at...)}
+}
+
+// addAt appends an error with the given message about the
+// part of an Expr at the path at.
+func (l *ErrorList) addAt(msg string, at ...int) {
+	*l = append(*l, errorAt(msg, at...))
+}
+
+// mergeAt appends the errors of err, the error of checking
+// operand i of an Expr, to the list.  Those whose Span is not
+// yet known are now about a part of the Expr, not the operand.
+func (l *ErrorList) mergeAt(i int, err error) {
+	var errs ErrorList
+	errs.merge(err)
+	for _, e := range errs {
+		if e.at != nil {
+			e = &Error{e.Span, e.Msg, append([]int{i}, e.at...)}
+		}
+		*l = append(*l, e)
+	}
+}
+
+// locate returns err with the Spans of its errors found from t,
+// the spanTree of the Expr whose Check reported them.
+func locate(err error, t *spanTree) error {
+	var errs ErrorList
+	errs.merge(err)
+	if errs == nil || t == nil {
+		return err
+	}
+	for i, e := range errs {
+		if e.at == nil {
+			continue
+		}
+		span := t
+		for _, kid := range e.at {
+			span = span.kids[kid]
+		}
+		errs[i] = &Error{Span: span.Span, Msg: e.Msg}
+	}
+	return errs.Err()
+}
+
+// merge appends the errors of err, if any, to the list.
+func (l *ErrorList) merge(err error) {
+	switch err := err.(type) {
+	case nil:
+		// no errors
+	case ErrorList:
+		*l = append(*l, err...)
+	case *Error:
+		*l = append(*l, err)
+	default:
+		l.Add(Span{}, err.Error())
+	}
+}
+
+// Err returns an error equivalent to the list, sorted by position
+// and without duplicates, or nil if the list is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	sort.SliceStable(l, func(i, j int) bool { return before(l[i].Start, l[j].Start) })
+	var out ErrorList
+	for _, e := range l {
+		if n := len(out); n > 0 && out[n-1].same(e) {
+			continue // duplicate, e.g., from two calls to one function
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// Error returns the message of the first error, and the number of others.
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// before reports whether position p precedes q.
+func before(p, q Pos) bool {
+	if p.Line != q.Line {
+		return p.Line < q.Line
+	}
+	return p.Column < q.Column
+}
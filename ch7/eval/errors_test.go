@@ -0,0 +1,58 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestErrorList(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  string // errors from Parse or Check, one per line
+	}{
+		// Parse errors.
+		{"x % 2", "1:3-1:4: unexpected '%'"},
+		{"x % 2 + y % 3", "1:3-1:4: unexpected '%'\n1:11-1:12: unexpected '%'"},
+		{"(x % 2) + (y % 3)", "1:4-1:5: got '%', want ')'\n1:14-1:15: got '%', want ')'"},
+		{"sqrt(1 2) + sin(3 4)", "1:8-1:9: got number 2, want ')'\n1:19-1:20: got number 4, want ')'"},
+		{"x +\n* y\n+ )", "2:1-2:2: unexpected '*'\n3:3-3:4: unexpected ')'"},
+		{`"hello" + "world"`, "1:1-1:2: unexpected '\"'\n1:11-1:12: unexpected '\"'"},
+		{"x > 0 ? 1", "1:10-1:10: got end of file, want ':'"},
+		{"f(x, x) = x; f(1, 2) = 3; 0", "1:6-1:7: duplicate parameter x of f\n1:14-1:21: function f redefined"},
+		{"1e999 + 1", "1:1-1:6: strconv.ParseFloat: parsing \"1e999\": value out of range"},
+
+		// Check errors.
+		{"log(10) + sqrt(1, 2)", "1:1-1:8: unknown function \"log\"\n1:11-1:21: call to sqrt has 2 args, want 1"},
+		{"x && (y < 1) + 2", "1:1-1:2: non-boolean operand x of &&\n1:7-1:12: boolean operand (y < 1) of +\n1:7-1:17: non-boolean operand ((y < 1) + 2) of &&"},
+		{"x ?\n  1 :\n  y > 0", "1:1-1:2: non-boolean condition x in ?:\n1:1-3:8: mismatched operands 1 and (y > 0) of ?:"},
+		{"f(a) = log(a); f(1) + f(2)", "1:8-1:14: unknown function \"log\""},
+	} {
+		src, err := ParseSource(test.input)
+		if err == nil {
+			err = src.Check(map[Var]bool{})
+		}
+		errs, ok := err.(ErrorList)
+		if !ok {
+			t.Errorf("%q: got %T %v, want ErrorList", test.input, err, err)
+			continue
+		}
+		var lines []string
+		for _, e := range errs {
+			lines = append(lines, fmt.Sprintf("%s-%s: %s", e.Start, e.End, e.Msg))
+		}
+		if got := strings.Join(lines, "\n"); got != test.want {
+			t.Errorf("%q: got errors\n%s\nwant\n%s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestErrorListError(t *testing.T) {
+	_, err := Parse("x % 2 + y % 3 + z % 4")
+	if want := "unexpected '%' (and 2 more errors)"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
@@ -4,12 +4,15 @@
 // See page 198.
 
 // Package eval provides an expression evaluator.
+//
+// Expressions may call the Builtins functions, functions defined
+// within the expression, such as f in "f(x) = x*x+1; f(3)", and the
+// functions of a Registry supplied by the client.  A Registry may be
+// passed to Parse, by calling its Parse method, or to Check and Eval,
+// by calling its methods of those names.
 package eval
 
-import (
-	"fmt"
-	"math"
-)
+import "fmt"
 
 //!+env
 
@@ -33,38 +36,72 @@ func (l literal) Eval(_ Env) float64 {
 
 func (u unary) Eval(env Env) float64 {
 	switch u.op {
-	case '+':
+	case "+":
 		return +u.x.Eval(env)
-	case '-':
+	case "-":
 		return -u.x.Eval(env)
+	case "!":
+		return truth(u.x.Eval(env) == 0)
 	}
 	panic(fmt.Sprintf("unsupported unary operator: %q", u.op))
 }
 
 func (b binary) Eval(env Env) float64 {
 	switch b.op {
-	case '+':
+	case "+":
 		return b.x.Eval(env) + b.y.Eval(env)
-	case '-':
+	case "-":
 		return b.x.Eval(env) - b.y.Eval(env)
-	case '*':
+	case "*":
 		return b.x.Eval(env) * b.y.Eval(env)
-	case '/':
+	case "/":
 		return b.x.Eval(env) / b.y.Eval(env)
+	case "<":
+		return truth(b.x.Eval(env) < b.y.Eval(env))
+	case "<=":
+		return truth(b.x.Eval(env) <= b.y.Eval(env))
+	case ">":
+		return truth(b.x.Eval(env) > b.y.Eval(env))
+	case ">=":
+		return truth(b.x.Eval(env) >= b.y.Eval(env))
+	case "==":
+		return truth(b.x.Eval(env) == b.y.Eval(env))
+	case "!=":
+		return truth(b.x.Eval(env) != b.y.Eval(env))
+	case "&&":
+		return truth(b.x.Eval(env) != 0 && b.y.Eval(env) != 0)
+	case "||":
+		return truth(b.x.Eval(env) != 0 || b.y.Eval(env) != 0)
 	}
 	panic(fmt.Sprintf("unsupported binary operator: %q", b.op))
 }
 
 func (c call) Eval(env Env) float64 {
-	switch c.fn {
-	case "pow":
-		return math.Pow(c.args[0].Eval(env), c.args[1].Eval(env))
-	case "sin":
-		return math.Sin(c.args[0].Eval(env))
-	case "sqrt":
-		return math.Sqrt(c.args[0].Eval(env))
+	f := c.fun()
+	if f == nil {
+		panic(fmt.Sprintf("unsupported function call: %s", c.fn))
 	}
-	panic(fmt.Sprintf("unsupported function call: %s", c.fn))
+	args := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.Eval(env)
+	}
+	return f.call(env, args)
 }
 
 //!-Eval2
+
+func (c conditional) Eval(env Env) float64 {
+	if c.cond.Eval(env) != 0 {
+		return c.x.Eval(env)
+	}
+	return c.y.Eval(env)
+}
+
+// truth converts a boolean to the value used for it by
+// comparison and logical operators: 1 for true, 0 for false.
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -9,27 +9,40 @@ import (
 	"testing"
 )
 
+// evalTests is shared by TestEval and TestCompile.
 //!+Eval
+var evalTests = []struct {
+	expr string
+	env  Env
+	want string
+}{
+	{"sqrt(A / pi)", Env{"A": 87616, "pi": math.Pi}, "167"},
+	{"pow(x, 3) + pow(y, 3)", Env{"x": 12, "y": 1}, "1729"},
+	{"pow(x, 3) + pow(y, 3)", Env{"x": 9, "y": 10}, "1729"},
+	{"5 / 9 * (F - 32)", Env{"F": -40}, "-40"},
+	{"5 / 9 * (F - 32)", Env{"F": 32}, "0"},
+	{"5 / 9 * (F - 32)", Env{"F": 212}, "100"},
+	//!-Eval
+	// additional tests that don't appear in the book
+	{"-1 + -x", Env{"x": 1}, "-2"},
+	{"-1 - x", Env{"x": 1}, "-2"},
+	{"x > 10 ? a : b", Env{"x": 11, "a": 1, "b": 2}, "1"},
+	{"x > 10 ? a : b", Env{"x": 10, "a": 1, "b": 2}, "2"},
+	{"x >= 0 && y < 5", Env{"x": 0, "y": 4}, "1"},
+	{"x >= 0 && y < 5", Env{"x": -1, "y": 4}, "0"},
+	{"x < 0 || x > 1 || !(y <= 2)", Env{"x": 0.5, "y": 3}, "1"},
+	{"x < 0 || x > 1 || !(y <= 2)", Env{"x": 0.5, "y": 2}, "0"},
+	{"x == 1 != (y != 1)", Env{"x": 1, "y": 1}, "1"},
+	{"1 + 2 * 3 == 7", nil, "1"},
+	{"x < 0 ? -1 : x > 0 ? 1 : 0", Env{"x": -5}, "-1"},
+	{"x < 0 ? -1 : x > 0 ? 1 : 0", Env{"x": 0}, "0"},
+	{"x < 0 ? -1 : x > 0 ? 1 : 0", Env{"x": 5}, "1"},
+	//!+Eval
+}
+
 func TestEval(t *testing.T) {
-	tests := []struct {
-		expr string
-		env  Env
-		want string
-	}{
-		{"sqrt(A / pi)", Env{"A": 87616, "pi": math.Pi}, "167"},
-		{"pow(x, 3) + pow(y, 3)", Env{"x": 12, "y": 1}, "1729"},
-		{"pow(x, 3) + pow(y, 3)", Env{"x": 9, "y": 10}, "1729"},
-		{"5 / 9 * (F - 32)", Env{"F": -40}, "-40"},
-		{"5 / 9 * (F - 32)", Env{"F": 32}, "0"},
-		{"5 / 9 * (F - 32)", Env{"F": 212}, "100"},
-		//!-Eval
-		// additional tests that don't appear in the book
-		{"-1 + -x", Env{"x": 1}, "-2"},
-		{"-1 - x", Env{"x": 1}, "-2"},
-		//!+Eval
-	}
 	var prevExpr string
-	for _, test := range tests {
+	for _, test := range evalTests {
 		// Print expr only when it changes.
 		if test.expr != prevExpr {
 			fmt.Printf("\n%s\n", test.expr)
@@ -79,10 +92,21 @@ func TestErrors(t *testing.T) {
 	for _, test := range []struct{ expr, wantErr string }{
 		{"x % 2", "unexpected '%'"},
 		{"math.Pi", "unexpected '.'"},
-		{"!true", "unexpected '!'"},
+		{"!true", "non-boolean operand true of !"},
 		{`"hello"`, "unexpected '\"'"},
 		{"log(10)", `unknown function "log"`},
 		{"sqrt(1, 2)", "call to sqrt has 2 args, want 1"},
+		{"x = 1", "unexpected '='"},
+		{"x & y", "unexpected '&'"},
+		{"x ? 1 : 2", "non-boolean condition x in ?:"},
+		{"x > 0 ? 1", "got end of file, want ':'"},
+		{"x > 0 ? 1 : y < 0", "mismatched operands 1 and (y < 0) of ?:"},
+		{"x && y > 0", "non-boolean operand x of &&"},
+		{"(x < y) + 1", "boolean operand (x < y) of +"},
+		{"x < y < z", "boolean operand (x < y) of <"},
+		{"x == (y < z)", "boolean operand (y < z) of =="},
+		{"sqrt(x > 0)", "boolean argument (x > 0) in call to sqrt"},
+		{"1 <= <= 2", "unexpected \"<=\""},
 	} {
 		expr, err := Parse(test.expr)
 		if err == nil {
@@ -100,6 +124,36 @@ func TestErrors(t *testing.T) {
 	}
 }
 
+func TestFormat(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"-x + y * 2", "((-x) + (y * 2))"},
+		{"x >= 0 && y < 5 || !(z != 1)", "(((x >= 0) && (y < 5)) || (!(z != 1)))"},
+		{"x > 10 ? a : b", "((x > 10) ? a : b)"},
+		{"a ? b ? 1 : 2 : c ? 3 : 4", "(a ? (b ? 1 : 2) : (c ? 3 : 4))"},
+		{"pow(x, 2) == sin(y)", "(pow(x, 2) == sin(y))"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got := Format(expr)
+		if got != test.want {
+			t.Errorf("Format(%s) = %s, want %s", test.expr, got, test.want)
+			continue
+		}
+		// Formatting must round-trip through Parse.
+		expr2, err := Parse(got)
+		if err != nil {
+			t.Errorf("%s: %v", got, err)
+			continue
+		}
+		if got2 := Format(expr2); got2 != got {
+			t.Errorf("Format(Parse(%s)) = %s", got, got2)
+		}
+	}
+}
+
 /*
 //!+errors
 x % 2               unexpected '%'
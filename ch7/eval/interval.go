@@ -0,0 +1,282 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+)
+
+// An Interval is the closed range of real numbers [Lo, Hi].
+type Interval struct {
+	Lo, Hi float64
+}
+
+// Point returns the interval containing only x.
+func Point(x float64) Interval { return Interval{x, x} }
+
+// Contains reports whether x lies within the interval.
+func (x Interval) Contains(y float64) bool { return x.Lo <= y && y <= x.Hi }
+
+func (x Interval) String() string { return fmt.Sprintf("[%g, %g]", x.Lo, x.Hi) }
+
+// An IntervalEnv maps variables to the intervals of their possible values.
+type IntervalEnv map[Var]Interval
+
+var (
+	entire       = Interval{math.Inf(-1), math.Inf(+1)}
+	falseTruth   = Point(0)
+	trueTruth    = Point(1)
+	unknownTruth = Interval{0, 1}
+)
+
+// EvalInterval returns an interval that contains the value of e
+// for every assignment of values to its variables drawn from the
+// intervals of env.  Arithmetic is rounded outward, so the result
+// is guaranteed to enclose the exact value, though it may be wider
+// than necessary.
+//
+// Comparisons and logical operators yield [1, 1] if they are true
+// for all values, [0, 0] if false for all, and [0, 1] otherwise.
+// EvalInterval panics if e calls a function without an
+// Interval implementation.
+//
+// A conditional whose condition is neither true for all values
+// nor false for all yields the hull of both operands, so a
+// recursive function whose base case the intervals cannot decide,
+// as in "count(n) = n > 0 ? 1 + count(n - 1) : 0; count(x)" with x
+// in [0, +Inf], recurses until its calls nest more deeply than
+// MaxDepth, and EvalInterval panics with ErrDepth.  Use
+// Registry.EvalInterval to report this as an error.
+func EvalInterval(e Expr, env IntervalEnv) Interval {
+	switch e := e.(type) {
+	case literal:
+		return Point(float64(e))
+
+	case Var:
+		return env[e]
+
+	case unary:
+		x := EvalInterval(e.x, env)
+		switch e.op {
+		case "+":
+			return x
+		case "-":
+			return Interval{-x.Hi, -x.Lo}
+		case "!":
+			return x.not()
+		}
+		panic(fmt.Sprintf("unsupported unary operator: %q", e.op))
+
+	case binary:
+		x := EvalInterval(e.x, env)
+		y := EvalInterval(e.y, env)
+		switch e.op {
+		case "+":
+			return widen(x.Lo+y.Lo, x.Hi+y.Hi)
+		case "-":
+			return widen(x.Lo-y.Hi, x.Hi-y.Lo)
+		case "*":
+			return x.mul(y)
+		case "/":
+			return x.mul(y.recip())
+		case "<":
+			return x.less(y, false)
+		case "<=":
+			return x.less(y, true)
+		case ">":
+			return y.less(x, false)
+		case ">=":
+			return y.less(x, true)
+		case "==":
+			return x.equal(y)
+		case "!=":
+			return x.equal(y).not()
+		case "&&":
+			return x.not().or(y.not()).not()
+		case "||":
+			return x.or(y)
+		}
+		panic(fmt.Sprintf("unsupported binary operator: %q", e.op))
+
+	case conditional:
+		switch EvalInterval(e.cond, env) {
+		case trueTruth:
+			return EvalInterval(e.x, env)
+		case falseTruth:
+			return EvalInterval(e.y, env)
+		}
+		return EvalInterval(e.x, env).hull(EvalInterval(e.y, env))
+
+	case call:
+		f := e.fun()
+		args := make([]Interval, len(e.args))
+		for i, arg := range e.args {
+			args[i] = EvalInterval(arg, env)
+		}
+		if f != nil && f.body != nil {
+			local := make(IntervalEnv, len(env)+len(args)+1)
+			for v, x := range env {
+				local[v] = x
+			}
+			for i, param := range f.params {
+				local[param] = args[i]
+			}
+			local[depth] = Point(enter(env[depth].Lo))
+			return EvalInterval(f.body, local)
+		}
+		if f == nil || f.Interval == nil {
+			panic(fmt.Sprintf("unsupported function call: %s", e.fn))
+		}
+		return f.Interval(args)
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+// EvalInterval is like the EvalInterval function, but with the
+// calls of e bound to the functions of r and the Builtins, as by
+// r.Parse.  Unlike that function, which panics, it returns
+// ErrDepth if the calls of functions defined within e nest more
+// deeply than MaxDepth.
+func (r Registry) EvalInterval(e Expr, env IntervalEnv) (x Interval, err error) {
+	defer recoverDepth(&err)
+	return EvalInterval(r.bind(e, make(map[*Func]*Func)), env), nil
+}
+
+// widen returns [lo, hi] rounded outward by one unit in the last
+// place, to enclose the exact result of an inexact operation.
+func widen(lo, hi float64) Interval {
+	return Interval{math.Nextafter(lo, math.Inf(-1)), math.Nextafter(hi, math.Inf(+1))}
+}
+
+// hull returns the smallest interval containing x and y.
+func (x Interval) hull(y Interval) Interval {
+	return Interval{math.Min(x.Lo, y.Lo), math.Max(x.Hi, y.Hi)}
+}
+
+func (x Interval) mul(y Interval) Interval {
+	lo, hi := math.Inf(+1), math.Inf(-1)
+	for _, p := range [...]float64{x.Lo * y.Lo, x.Lo * y.Hi, x.Hi * y.Lo, x.Hi * y.Hi} {
+		if math.IsNaN(p) {
+			p = 0 // 0 × ∞
+		}
+		lo, hi = math.Min(lo, p), math.Max(hi, p)
+	}
+	return widen(lo, hi)
+}
+
+// recip returns the interval of 1/y for y in x.
+func (x Interval) recip() Interval {
+	switch {
+	case x.Lo > 0 || x.Hi < 0:
+		return widen(1/x.Hi, 1/x.Lo)
+	case x.Lo == 0 && x.Hi > 0:
+		return Interval{math.Nextafter(1/x.Hi, 0), math.Inf(+1)}
+	case x.Hi == 0 && x.Lo < 0:
+		return Interval{math.Inf(-1), math.Nextafter(1/x.Lo, 0)}
+	}
+	return entire // x contains zero in its interior, or is [0, 0]
+}
+
+func (x Interval) sqrt() Interval {
+	if x.Hi < 0 {
+		return Interval{math.NaN(), math.NaN()}
+	}
+	return widen(math.Sqrt(math.Max(x.Lo, 0)), math.Sqrt(x.Hi))
+}
+
+func (x Interval) sin() Interval {
+	if x.Hi-x.Lo >= 2*math.Pi {
+		return Interval{-1, 1}
+	}
+	lo := math.Min(math.Sin(x.Lo), math.Sin(x.Hi))
+	hi := math.Max(math.Sin(x.Lo), math.Sin(x.Hi))
+	// Does x contain a maximum, π/2 + 2kπ, or a minimum, -π/2 + 2kπ?
+	if k := math.Ceil((x.Lo - math.Pi/2) / (2 * math.Pi)); math.Pi/2+2*math.Pi*k <= x.Hi {
+		hi = 1
+	}
+	if k := math.Ceil((x.Lo + math.Pi/2) / (2 * math.Pi)); -math.Pi/2+2*math.Pi*k <= x.Hi {
+		lo = -1
+	}
+	r := widen(lo, hi)
+	return Interval{math.Max(r.Lo, -1), math.Min(r.Hi, 1)}
+}
+
+// pow returns the interval of pow(a, b) for a in x and b in y.
+func (x Interval) pow(y Interval) Interval {
+	if n := y.Lo; n == y.Hi && n == math.Trunc(n) {
+		// Integer exponent: pow is monotonic in |a|, and,
+		// for odd n, preserves sign.
+		p, q := math.Pow(x.Lo, n), math.Pow(x.Hi, n)
+		switch {
+		case n == 0:
+			return Point(1)
+		case x.Lo > 0 || x.Hi < 0 || math.Mod(n, 2) != 0 && n > 0:
+			return widen(math.Min(p, q), math.Max(p, q))
+		case n > 0: // even, and x contains 0
+			return Interval{0, math.Nextafter(math.Max(p, q), math.Inf(+1))}
+		case math.Mod(n, 2) == 0: // negative even, and x contains 0
+			return Interval{math.Nextafter(math.Min(p, q), 0), math.Inf(+1)}
+		}
+		return entire // negative odd, and x contains 0
+	}
+	if x.Lo < 0 {
+		return entire // pow(a, b) is NaN for some a < 0
+	}
+	// For a ≥ 0, pow(a, b) = exp(b log a) is monotonic in
+	// each argument, so its extrema lie at the corners.
+	lo, hi := math.Inf(+1), math.Inf(-1)
+	for _, a := range [...]float64{x.Lo, x.Hi} {
+		for _, b := range [...]float64{y.Lo, y.Hi} {
+			p := math.Pow(a, b)
+			lo, hi = math.Min(lo, p), math.Max(hi, p)
+		}
+	}
+	return widen(lo, hi)
+}
+
+// less returns the truth of a < b, or a <= b if orEqual,
+// for a in x and b in y.
+func (x Interval) less(y Interval, orEqual bool) Interval {
+	switch {
+	case x.Hi < y.Lo || orEqual && x.Hi == y.Lo:
+		return trueTruth
+	case x.Lo > y.Hi || !orEqual && x.Lo == y.Hi:
+		return falseTruth
+	}
+	return unknownTruth
+}
+
+// equal returns the truth of a == b for a in x and b in y.
+func (x Interval) equal(y Interval) Interval {
+	switch {
+	case x.Lo == x.Hi && x == y:
+		return trueTruth
+	case x.Hi < y.Lo || y.Hi < x.Lo:
+		return falseTruth
+	}
+	return unknownTruth
+}
+
+// not returns the truth of !a for a in x.
+func (x Interval) not() Interval {
+	switch {
+	case x == falseTruth:
+		return trueTruth
+	case !x.Contains(0):
+		return falseTruth
+	}
+	return unknownTruth
+}
+
+// or returns the truth of a || b for a in x and b in y.
+func (x Interval) or(y Interval) Interval {
+	switch xf, yf := x.not(), y.not(); {
+	case xf == falseTruth || yf == falseTruth:
+		return trueTruth // one is certainly true
+	case xf == trueTruth && yf == trueTruth:
+		return falseTruth
+	}
+	return unknownTruth
+}
@@ -0,0 +1,132 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEvalInterval(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		env  IntervalEnv
+		want Interval // must be contained in the result
+	}{
+		{"x + y", IntervalEnv{"x": {1, 2}, "y": {10, 20}}, Interval{11, 22}},
+		{"x - y", IntervalEnv{"x": {1, 2}, "y": {10, 20}}, Interval{-19, -8}},
+		{"x * y", IntervalEnv{"x": {-1, 2}, "y": {-3, 4}}, Interval{-6, 8}},
+		{"1 / x", IntervalEnv{"x": {2, 4}}, Interval{0.25, 0.5}},
+		{"1 / x", IntervalEnv{"x": {0, 4}}, Interval{0.25, math.Inf(+1)}},
+		{"pow(x, 2)", IntervalEnv{"x": {-3, 2}}, Interval{0, 9}},
+		{"pow(x, 3)", IntervalEnv{"x": {-3, 2}}, Interval{-27, 8}},
+		{"pow(x, 0.5)", IntervalEnv{"x": {4, 9}}, Interval{2, 3}},
+		{"sqrt(x)", IntervalEnv{"x": {4, 9}}, Interval{2, 3}},
+		{"sin(x)", IntervalEnv{"x": {0, math.Pi}}, Interval{0, 1}},
+		{"sin(x)", IntervalEnv{"x": {-10, 10}}, Interval{-1, 1}},
+		{"x > 0 ? x : -x", IntervalEnv{"x": {1, 2}}, Interval{1, 2}},
+		{"x > 0 ? x : -x", IntervalEnv{"x": {-3, 2}}, Interval{-3, 3}},
+		{"x > 10", IntervalEnv{"x": {11, 12}}, Point(1)},
+		{"x > 10", IntervalEnv{"x": {9, 12}}, Interval{0, 1}},
+		{"x >= 0 && y < 5", IntervalEnv{"x": {1, 2}, "y": {6, 7}}, Point(0)},
+		{"x >= 0 || y < 5", IntervalEnv{"x": {1, 2}, "y": {6, 7}}, Point(1)},
+		{"f(a) = a * a; f(x)", IntervalEnv{"x": {2, 3}}, Interval{4, 9}},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		got := EvalInterval(expr, test.env)
+		// The result must enclose want, but be no more than
+		// a few units in the last place wider.
+		if !got.Contains(test.want.Lo) || !got.Contains(test.want.Hi) ||
+			!nearlyEqual(got.Lo, test.want.Lo) || !nearlyEqual(got.Hi, test.want.Hi) {
+			t.Errorf("%s in %v = %v, want %v", test.expr, test.env, got, test.want)
+		}
+	}
+}
+
+// TestEvalIntervalDepth checks the recursion that intervals cannot
+// decide, which reaches MaxDepth.
+func TestEvalIntervalDepth(t *testing.T) {
+	expr, err := Parse("count(n) = n > 0 ? 1 + count(n - 1) : 0; count(x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := IntervalEnv{"x": {0, math.Inf(+1)}}
+	if got, err := Registry(nil).EvalInterval(expr, env); err != ErrDepth {
+		t.Errorf("count(x) in %v = %v, %v; want error %v", env, got, err, ErrDepth)
+	}
+	func() {
+		defer func() {
+			if p := recover(); p != ErrDepth {
+				t.Errorf("EvalInterval: got panic %v, want %v", p, ErrDepth)
+			}
+		}()
+		EvalInterval(expr, env)
+	}()
+
+	// A decidable recursion yields its value.
+	env = IntervalEnv{"x": Point(5)}
+	if got, err := Registry(nil).EvalInterval(expr, env); err != nil || !got.Contains(5) {
+		t.Errorf("count(x) in %v = %v, %v; want interval containing 5", env, got, err)
+	}
+}
+
+func nearlyEqual(x, y float64) bool {
+	return x == y || math.Abs(x-y) <= 1e-12*math.Max(1, math.Max(math.Abs(x), math.Abs(y)))
+}
+
+// TestEvalIntervalEncloses checks that the values of expressions
+// at random points lie within the interval computed for a box
+// containing them.
+func TestEvalIntervalEncloses(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() float64 { return (rng.Float64() - 0.5) * 20 }
+	for _, input := range []string{
+		"sqrt(A / pi)",
+		"pow(x, 3) + pow(y, 3)",
+		"5 / 9 * (F - 32)",
+		"x * y - x / (y * y + 1)",
+		"sin(x) * sin(y) / (1 + x * x)",
+		"x < y ? pow(x, 2) : -y",
+		"x >= 0 && y < 5",
+		"pow(sqrt(x * x + 1), y / 4)",
+	} {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		vars := make(map[Var]bool)
+		if err := expr.Check(vars); err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		for i := 0; i < 100; i++ {
+			box := IntervalEnv{}
+			for v := range vars {
+				a, b := random(), random()
+				box[v] = Interval{math.Min(a, b), math.Max(a, b)}
+			}
+			if _, ok := vars["A"]; ok {
+				box["A"] = Interval{math.Abs(box["A"].Hi), math.Abs(box["A"].Hi) + 1}
+				box["pi"] = Point(math.Pi)
+			}
+			bounds := EvalInterval(expr, box)
+			for j := 0; j < 20; j++ {
+				env := Env{}
+				for v, x := range box {
+					env[v] = x.Lo + rng.Float64()*(x.Hi-x.Lo)
+				}
+				if y := expr.Eval(env); !math.IsNaN(y) && !bounds.Contains(y) {
+					t.Errorf("%s: Eval(%v) = %g, not within %v for box %v",
+						input, env, y, bounds, box)
+				}
+			}
+		}
+	}
+}
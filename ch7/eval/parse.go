@@ -5,6 +5,7 @@ package eval
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"text/scanner"
@@ -15,13 +16,56 @@ import (
 // This lexer is similar to the one described in Chapter 13.
 type lexer struct {
 	scan  scanner.Scanner
-	token rune // current lookahead token
+	token rune   // current lookahead token
+	op    string // text of token if it is an operator, e.g., "<="
+	span  Span   // span of token
+	ntok  int    // number of tokens scanned
+
+	errs    ErrorList
+	lastErr int // value of ntok at the most recent error
+
+	funcs  Registry       // functions supplied by the client
+	defs   Registry       // functions defined within the input
+	params map[string]Var // parameters of the definition being parsed
+}
+
+func (lex *lexer) next() {
+	lex.token = lex.scan.Scan()
+	start := lex.scan.Position
+	lex.op = ""
+	switch lex.token {
+	case '+', '-', '*', '/', '?', ':', ';':
+		lex.op = string(lex.token)
+	case '<', '>', '=', '!', '&', '|':
+		lex.op = string(lex.token)
+		if op := lex.op + string(lex.scan.Peek()); twoCharOps[op] {
+			lex.scan.Next() // consume second character
+			lex.op = op
+		}
+	}
+	lex.span = Span{pos(start), pos(lex.scan.Pos())}
+	lex.ntok++
 }
 
-func (lex *lexer) next()        { lex.token = lex.scan.Scan() }
 func (lex *lexer) text() string { return lex.scan.TokenText() }
 
-type lexPanic string
+// twoCharOps is the set of operators spelled with two characters.
+var twoCharOps = map[string]bool{
+	"<=": true, ">=": true, "==": true, "!=": true, "&&": true, "||": true,
+}
+
+func pos(p scanner.Position) Pos { return Pos{p.Line, p.Column} }
+
+// errorf records a syntax error.  To avoid a cascade of
+// spurious errors, it discards errors that occur within a
+// token of the previous one, so that the parser reports
+// no more errors until it is back in step with the input.
+func (lex *lexer) errorf(span Span, format string, args ...interface{}) {
+	if lex.ntok > lex.lastErr+1 {
+		lex.errs.Add(span, fmt.Sprintf(format, args...))
+	}
+	lex.lastErr = lex.ntok
+}
 
 // describe returns a string describing the current token, for use in errors.
 func (lex *lexer) describe() string {
@@ -33,76 +77,257 @@ func (lex *lexer) describe() string {
 	case scanner.Int, scanner.Float:
 		return fmt.Sprintf("number %s", lex.text())
 	}
+	if len(lex.op) > 1 {
+		return fmt.Sprintf("%q", lex.op)
+	}
 	return fmt.Sprintf("%q", rune(lex.token)) // any other rune
 }
 
-func precedence(op rune) int {
+func precedence(op string) int {
 	switch op {
-	case '*', '/':
+	case "*", "/":
+		return 6
+	case "+", "-":
+		return 5
+	case "<", "<=", ">", ">=":
+		return 4
+	case "==", "!=":
+		return 3
+	case "&&":
 		return 2
-	case '+', '-':
+	case "||":
 		return 1
 	}
 	return 0
 }
 
+// lookup returns the function called name, or nil if there is none
+// besides perhaps one of the Builtins, which calls look up when
+// evaluated.  Functions defined within the input take precedence
+// over those supplied by the client, which take precedence over Builtins.
+func (lex *lexer) lookup(name string) *Func {
+	if f := lex.defs[name]; f != nil {
+		return f
+	}
+	return lex.funcs[name]
+}
+
 // ---- parser ----
 
-// Parse parses the input string as an arithmetic expression.
+// Parse parses the input string as an arithmetic expression
+// that may call the Builtins functions.
+//
+//   program = def ';' ... def ';' expr  definitions followed by an expression
+//   def     = id '(' id ',' ... ')' '=' expr
+//                                       a function definition, e.g., f(x) = x*x
 //
 //   expr = num                         a literal number, e.g., 3.14159
 //        | id                          a variable name, e.g., x
 //        | id '(' expr ',' ... ')'     a function call
-//        | '-' expr                    a unary operator (+-)
-//        | expr '+' expr               a binary operator (+-*/)
+//        | '-' expr                    a unary operator (+-!)
+//        | expr '+' expr               a binary operator (+-*/ < <= > >= == != && ||)
+//        | expr '?' expr ':' expr      a conditional expression
 //
-func Parse(input string) (_ Expr, err error) {
-	defer func() {
-		switch x := recover().(type) {
-		case nil:
-			// no panic
-		case lexPanic:
-			err = fmt.Errorf("%s", x)
-		default:
-			// unexpected panic: resume state of panic.
-			panic(x)
-		}
-	}()
-	lex := new(lexer)
+// If the input contains syntax errors, Parse reports them all
+// as an ErrorList.  The errors reported by Check of the result
+// have no positions; for those, use ParseSource.
+func Parse(input string) (Expr, error) { return Registry(nil).Parse(input) }
+
+// Parse parses the input string as an arithmetic expression
+// that may call the functions of r as well as Builtins.
+// The functions are bound to their calls during parsing,
+// so later changes to r do not affect the result; to check or
+// evaluate the result with other functions, use the Check and
+// Eval methods of another Registry.
+func (r Registry) Parse(input string) (Expr, error) {
+	src, err := r.ParseSource(input)
+	if err != nil {
+		return nil, err
+	}
+	return src.Expr, nil
+}
+
+// A Source is an expression parsed from text, with the spans of the
+// text from which its parts were parsed.  The spans are kept apart
+// from the Expr, which is no different from one built directly.
+type Source struct {
+	Expr  Expr
+	spans *spanTree
+	defs  Registry // functions defined within the text
+}
+
+// ParseSource is like Parse, but also records the spans of the
+// parts of the expression, so that Source.Check can report the
+// position of each error.
+func ParseSource(input string) (*Source, error) { return Registry(nil).ParseSource(input) }
+
+// ParseSource is like r.Parse, but also records the spans of the
+// parts of the expression.
+func (r Registry) ParseSource(input string) (*Source, error) {
+	lex := &lexer{funcs: r, defs: make(Registry), lastErr: -1}
 	lex.scan.Init(strings.NewReader(input))
 	lex.scan.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats
+	lex.scan.Error = func(s *scanner.Scanner, msg string) {
+		p := s.Position
+		if !p.IsValid() {
+			p = s.Pos()
+		}
+		lex.errorf(Span{pos(p), pos(s.Pos())}, "%s", msg)
+	}
 	lex.next() // initial lookahead
-	e := parseExpr(lex)
-	if lex.token != scanner.EOF {
-		return nil, fmt.Errorf("unexpected %s", lex.describe())
+	e, spans := parseProgram(lex)
+	for lex.token != scanner.EOF {
+		// Report the unexpected token and resume parsing after it.
+		lex.errorf(lex.span, "unexpected %s", lex.describe())
+		lex.next()
+		if lex.token != scanner.EOF {
+			parseProgram(lex)
+		}
+	}
+	if err := lex.errs.Err(); err != nil {
+		return nil, err
+	}
+	return &Source{e, spans, lex.defs}, nil
+}
+
+// Check is like s.Expr.Check, but reports each error with the
+// span of the text responsible for it.
+func (s *Source) Check(vars map[Var]bool) error {
+	return locate(s.Expr.Check(vars), s.spans)
+}
+
+// Refs returns the spans of the references to the variable v, in
+// order, including those within the bodies of functions defined in
+// the text.  A variable that s.Check reports only because a function
+// of the Registry uses it has none.
+func (s *Source) Refs(v Var) []Span {
+	var refs []Span
+	seen := make(map[*Func]bool)
+	var visit func(e Expr, t *spanTree)
+	visit = func(e Expr, t *spanTree) {
+		switch e := e.(type) {
+		case Var:
+			if e == v {
+				refs = append(refs, t.Span)
+			}
+		case unary:
+			visit(e.x, t.kids[0])
+		case binary:
+			visit(e.x, t.kids[0])
+			visit(e.y, t.kids[1])
+		case conditional:
+			visit(e.cond, t.kids[0])
+			visit(e.x, t.kids[1])
+			visit(e.y, t.kids[2])
+		case call:
+			for i, arg := range e.args {
+				visit(arg, t.kids[i])
+			}
+			if f := e.f; f != nil && s.defs[e.fn] == f && !seen[f] {
+				seen[f] = true
+				visit(f.body, f.spans)
+			}
+		}
+	}
+	visit(s.Expr, s.spans)
+	sort.SliceStable(refs, func(i, j int) bool { return before(refs[i].Start, refs[j].Start) })
+	return refs
+}
+
+// The parse functions return each Expr with its spanTree.
+
+// program = (def ';')* expr
+func parseProgram(lex *lexer) (Expr, *spanTree) {
+	for {
+		e, spans := parseExpr(lex)
+		c, ok := e.(call)
+		if lex.op != "=" || !ok {
+			return e, spans // an unexpected '=' is reported by Parse
+		}
+		parseDef(lex, c, spans)
 	}
-	return e, nil
 }
 
-func parseExpr(lex *lexer) Expr { return parseBinary(lex, 1) }
+// def = id '(' id ',' ... ')' '=' expr
+// parseDef parses the remainder of a definition
+// whose head, e.g., f(x, y), has already been parsed.
+func parseDef(lex *lexer, head call, spans *spanTree) {
+	f := &Func{Arity: len(head.args)}
+	if lex.defs[head.fn] != nil {
+		lex.errorf(spans.Span, "function %s redefined", head.fn)
+	} else {
+		lex.defs[head.fn] = f // (before parsing the body, to allow recursion)
+	}
+	lex.params = make(map[string]Var)
+	for i, arg := range head.args {
+		id, ok := arg.(Var)
+		if !ok {
+			lex.errorf(spans.kids[i].Span, "parameter %s of %s is not a variable",
+				Format(arg), head.fn)
+			continue
+		}
+		if _, ok := lex.params[string(id)]; ok {
+			lex.errorf(spans.kids[i].Span, "duplicate parameter %s of %s", id, head.fn)
+			continue
+		}
+		param := Var(head.fn + "." + string(id))
+		lex.params[string(id)] = param
+		f.params = append(f.params, param)
+	}
+	lex.next() // consume '='
+	body, bodySpans := parseExpr(lex)
+	lex.params = nil
+	if lex.token != ';' {
+		lex.errorf(lex.span, "got %s, want ';'", lex.describe())
+	} else {
+		lex.next() // consume ';'
+	}
+	f.define(body, bodySpans)
+}
+
+// expr = binary ('?' expr ':' expr)?
+func parseExpr(lex *lexer) (Expr, *spanTree) {
+	cond, condSpans := parseBinary(lex, 1)
+	if lex.token != '?' {
+		return cond, condSpans
+	}
+	lex.next() // consume '?'
+	x, xSpans := parseExpr(lex)
+	var y Expr
+	var ySpans *spanTree
+	if lex.token != ':' {
+		lex.errorf(lex.span, "got %s, want ':'", lex.describe())
+		y, ySpans = literal(0), &spanTree{Span: lex.span} // placeholder
+	} else {
+		lex.next() // consume ':'
+		y, ySpans = parseExpr(lex)
+	}
+	return conditional{cond, x, y}, join(condSpans, xSpans, ySpans)
+}
 
 // binary = unary ('+' binary)*
 // parseBinary stops when it encounters an
 // operator of lower precedence than prec1.
-func parseBinary(lex *lexer, prec1 int) Expr {
-	lhs := parseUnary(lex)
-	for prec := precedence(lex.token); prec >= prec1; prec-- {
-		for precedence(lex.token) == prec {
-			op := lex.token
+func parseBinary(lex *lexer, prec1 int) (Expr, *spanTree) {
+	lhs, lhsSpans := parseUnary(lex)
+	for prec := precedence(lex.op); prec >= prec1; prec-- {
+		for precedence(lex.op) == prec {
+			op := lex.op
 			lex.next() // consume operator
-			rhs := parseBinary(lex, prec+1)
-			lhs = binary{op, lhs, rhs}
+			rhs, rhsSpans := parseBinary(lex, prec+1)
+			lhs, lhsSpans = binary{op, lhs, rhs}, join(lhsSpans, rhsSpans)
 		}
 	}
-	return lhs
+	return lhs, lhsSpans
 }
 
 // unary = '+' expr | primary
-func parseUnary(lex *lexer) Expr {
-	if lex.token == '+' || lex.token == '-' {
-		op := lex.token
-		lex.next() // consume '+' or '-'
-		return unary{op, parseUnary(lex)}
+func parseUnary(lex *lexer) (Expr, *spanTree) {
+	if lex.op == "+" || lex.op == "-" || lex.op == "!" {
+		op, start := lex.op, lex.span.Start
+		lex.next() // consume '+', '-' or '!'
+		x, xSpans := parseUnary(lex)
+		return unary{op, x}, &spanTree{Span{start, xSpans.End}, []*spanTree{xSpans}}
 	}
 	return parsePrimary(lex)
 }
@@ -111,50 +336,85 @@ func parseUnary(lex *lexer) Expr {
 //         | id '(' expr ',' ... ',' expr ')'
 //         | num
 //         | '(' expr ')'
-func parsePrimary(lex *lexer) Expr {
+func parsePrimary(lex *lexer) (Expr, *spanTree) {
 	switch lex.token {
 	case scanner.Ident:
-		id := lex.text()
+		id, span := lex.text(), lex.span
 		lex.next() // consume Ident
 		if lex.token != '(' {
-			return Var(id)
+			if param, ok := lex.params[id]; ok {
+				return param, &spanTree{Span: span}
+			}
+			return Var(id), &spanTree{Span: span}
 		}
 		lex.next() // consume '('
 		var args []Expr
+		var argSpans []*spanTree
 		if lex.token != ')' {
 			for {
-				args = append(args, parseExpr(lex))
+				arg, spans := parseExpr(lex)
+				args, argSpans = append(args, arg), append(argSpans, spans)
 				if lex.token != ',' {
 					break
 				}
 				lex.next() // consume ','
 			}
-			if lex.token != ')' {
-				msg := fmt.Sprintf("got %s, want ')'", lex.describe())
-				panic(lexPanic(msg))
-			}
 		}
-		lex.next() // consume ')'
-		return call{id, args}
+		span.End = lex.span.End
+		expectParen(lex)
+		return call{id, args, lex.lookup(id)}, &spanTree{span, argSpans}
 
 	case scanner.Int, scanner.Float:
+		span := lex.span
 		f, err := strconv.ParseFloat(lex.text(), 64)
 		if err != nil {
-			panic(lexPanic(err.Error()))
+			lex.errorf(span, "%s", err)
 		}
 		lex.next() // consume number
-		return literal(f)
+		return literal(f), &spanTree{Span: span}
 
 	case '(':
 		lex.next() // consume '('
-		e := parseExpr(lex)
-		if lex.token != ')' {
-			msg := fmt.Sprintf("got %s, want ')'", lex.describe())
-			panic(lexPanic(msg))
-		}
+		e, spans := parseExpr(lex)
+		expectParen(lex)
+		return e, spans
+	}
+	lex.errorf(lex.span, "unexpected %s", lex.describe())
+	bad := &spanTree{Span: lex.span} // of the placeholder
+	switch lex.token {
+	case scanner.EOF, ')', ',', ';', ':':
+		// Leave the token for the caller, which expects it.
+	default:
+		lex.next()
+	}
+	return literal(0), bad
+}
+
+// join returns the spanTree of an Expr with the given operands,
+// which spans from the start of the first to the end of the last.
+func join(kids ...*spanTree) *spanTree {
+	return &spanTree{Span{kids[0].Start, kids[len(kids)-1].End}, kids}
+}
+
+// expectParen consumes the ')' that closes a parenthesized
+// expression or argument list.  If it is not the current token,
+// expectParen reports an error and skips ahead to it.
+func expectParen(lex *lexer) {
+	if lex.token == ')' {
 		lex.next() // consume ')'
-		return e
+		return
+	}
+	lex.errorf(lex.span, "got %s, want ')'", lex.describe())
+	for depth := 0; lex.token != scanner.EOF && lex.token != ';'; lex.next() {
+		switch lex.token {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				lex.next() // consume ')'
+				return
+			}
+			depth--
+		}
 	}
-	msg := fmt.Sprintf("unexpected %s", lex.describe())
-	panic(lexPanic(msg))
 }
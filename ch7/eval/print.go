@@ -25,14 +25,23 @@ func write(buf *bytes.Buffer, e Expr) {
 		fmt.Fprintf(buf, "%s", e)
 
 	case unary:
-		fmt.Fprintf(buf, "(%c", e.op)
+		fmt.Fprintf(buf, "(%s", e.op)
 		write(buf, e.x)
 		buf.WriteByte(')')
 
 	case binary:
 		buf.WriteByte('(')
 		write(buf, e.x)
-		fmt.Fprintf(buf, " %c ", e.op)
+		fmt.Fprintf(buf, " %s ", e.op)
+		write(buf, e.y)
+		buf.WriteByte(')')
+
+	case conditional:
+		buf.WriteByte('(')
+		write(buf, e.cond)
+		buf.WriteString(" ? ")
+		write(buf, e.x)
+		buf.WriteString(" : ")
 		write(buf, e.y)
 		buf.WriteByte(')')
 
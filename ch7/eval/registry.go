@@ -0,0 +1,193 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+)
+
+// A Func is a function that may be called from an expression.
+type Func struct {
+	Arity    int                          // number of arguments, or the minimum if Variadic
+	Variadic bool                         // whether more than Arity arguments are allowed
+	Fn       func(args []float64) float64 // the implementation, which must not retain args
+
+	// Optional implementations for EvalInterval and EvalComplex.
+	Interval func(args []Interval) Interval
+	Complex  func(args []complex128) complex128
+
+	// Functions defined within an expression, e.g., f(x) = x*x,
+	// have a body in place of Fn.  Their parameters are given
+	// names such as "f.x" that cannot clash with other variables.
+	params []Var
+	body   Expr
+	free   map[Var]bool // variables of body, excluding params
+	err    error        // error reported by body.Check
+	spans  *spanTree    // spans of body, if parsed
+}
+
+// MaxDepth is the maximum depth of nested calls of functions
+// defined within an expression.  Evaluation of deeper calls, such
+// as those of f in "f(x) = f(x); f(1)", panics with ErrDepth
+// rather than exhausting the stack.
+const MaxDepth = 10000
+
+// ErrDepth is the value of the panic of an evaluation whose
+// calls nest more deeply than MaxDepth.
+var ErrDepth = errors.New("eval: function calls nested too deeply")
+
+// depth is the variable in the local environment of a call of a
+// function defined within an expression that holds the depth of
+// the call.  It is not an identifier, so expressions cannot use it.
+const depth Var = "#depth"
+
+// enter returns the depth of a call made at depth d.
+// It panics with ErrDepth if the result exceeds MaxDepth.
+func enter(d float64) float64 {
+	if d >= MaxDepth {
+		panic(ErrDepth)
+	}
+	return d + 1
+}
+
+// call applies f to args.  Functions defined within an
+// expression evaluate their body in env extended by args.
+func (f *Func) call(env Env, args []float64) float64 {
+	if f.body == nil {
+		return f.Fn(args)
+	}
+	local := make(Env, len(env)+len(args)+1)
+	for v, x := range env {
+		local[v] = x
+	}
+	for i, param := range f.params {
+		local[param] = args[i]
+	}
+	local[depth] = enter(env[depth])
+	return f.body.Eval(local)
+}
+
+// A Registry maps function names to functions.
+//
+// Parse binds each call to a function of the Registry passed to it.
+// Check and Eval of a Registry rebind the calls of an expression to
+// its functions, so that an expression parsed once may be checked
+// and evaluated with different functions.
+type Registry map[string]*Func
+
+// Check is like e.Check, but with the calls of e bound to the
+// functions of r and the Builtins, as by r.Parse.  Functions
+// defined within the expression still take precedence.
+func (r Registry) Check(e Expr, vars map[Var]bool) error {
+	return r.bind(e, make(map[*Func]*Func)).Check(vars)
+}
+
+// Eval is like e.Eval, but with the calls of e bound to the
+// functions of r and the Builtins, as by r.Parse.  Functions
+// defined within the expression still take precedence.
+// Binding takes time proportional to the size of e, so an
+// expression evaluated repeatedly is better parsed by r.Parse.
+//
+// Unlike e.Eval, which panics, Eval returns ErrDepth if the calls
+// of functions defined within e nest more deeply than MaxDepth, as
+// they may in a valid but unbounded recursion.
+func (r Registry) Eval(e Expr, env Env) (x float64, err error) {
+	defer recoverDepth(&err)
+	return r.bind(e, make(map[*Func]*Func)).Eval(env), nil
+}
+
+// recoverDepth, deferred, recovers from a panic with ErrDepth,
+// setting *err to ErrDepth.  Other panics continue.
+func recoverDepth(err *error) {
+	if p := recover(); p != nil {
+		if p != ErrDepth {
+			panic(p)
+		}
+		*err = ErrDepth
+	}
+}
+
+// bind returns a copy of e whose calls are bound to the functions
+// of r, unless they call functions defined within the expression,
+// which are copied with their bodies bound likewise.  defs maps
+// each such function to its copy.
+func (r Registry) bind(e Expr, defs map[*Func]*Func) Expr {
+	switch e := e.(type) {
+	case unary:
+		return unary{e.op, r.bind(e.x, defs)}
+	case binary:
+		return binary{e.op, r.bind(e.x, defs), r.bind(e.y, defs)}
+	case conditional:
+		return conditional{r.bind(e.cond, defs), r.bind(e.x, defs), r.bind(e.y, defs)}
+	case call:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			args[i] = r.bind(arg, defs)
+		}
+		f := e.f
+		if f == nil || f.body == nil {
+			return call{e.fn, args, r[e.fn]}
+		}
+		g := defs[f]
+		if g == nil {
+			g = &Func{Arity: f.Arity, params: f.params}
+			defs[f] = g // (before binding the body, to allow recursion)
+			g.define(r.bind(f.body, defs), f.spans)
+		}
+		return call{e.fn, args, g}
+	}
+	return e // literal or Var
+}
+
+// define sets the body of a function defined within an expression,
+// whose spans, if it was parsed, are given by spans.
+func (f *Func) define(body Expr, spans *spanTree) {
+	// Check the body now, while f.body is nil, so that
+	// recursive calls do not cause Check to recurse forever.
+	vars := make(map[Var]bool)
+	f.err = locate(body.Check(vars), spans)
+	for _, param := range f.params {
+		delete(vars, param)
+	}
+	f.body, f.free, f.spans = body, vars, spans
+}
+
+// Builtins defines the functions available to every expression.
+// It must not be modified; clients that need other functions
+// should pass their own Registry to Parse, Check or Eval.
+var Builtins = Registry{
+	"pow": {
+		Arity:    2,
+		Fn:       func(args []float64) float64 { return math.Pow(args[0], args[1]) },
+		Interval: func(args []Interval) Interval { return args[0].pow(args[1]) },
+		Complex:  func(args []complex128) complex128 { return cmplx.Pow(args[0], args[1]) },
+	},
+	"sin": {
+		Arity:    1,
+		Fn:       func(args []float64) float64 { return math.Sin(args[0]) },
+		Interval: func(args []Interval) Interval { return args[0].sin() },
+		Complex:  func(args []complex128) complex128 { return cmplx.Sin(args[0]) },
+	},
+	"sqrt": {
+		Arity:    1,
+		Fn:       func(args []float64) float64 { return math.Sqrt(args[0]) },
+		Interval: func(args []Interval) Interval { return args[0].sqrt() },
+		Complex:  func(args []complex128) complex128 { return cmplx.Sqrt(args[0]) },
+	},
+}
+
+// fun returns the function called by c, or nil if there is none.
+func (c call) fun() *Func {
+	if c.f != nil {
+		return c.f
+	}
+	return Builtins[c.fn]
+}
+
+// isBuiltin reports whether c calls the built-in function name.
+func (c call) isBuiltin(name string) bool {
+	return c.f == nil && c.fn == name
+}
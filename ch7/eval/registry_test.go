@@ -0,0 +1,220 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+var mathFuncs = Registry{
+	"cos": {Arity: 1, Fn: func(args []float64) float64 { return math.Cos(args[0]) }},
+	"log": {Arity: 1, Fn: func(args []float64) float64 { return math.Log(args[0]) }},
+	"min": {Arity: 1, Variadic: true, Fn: func(args []float64) float64 {
+		min := args[0]
+		for _, x := range args[1:] {
+			min = math.Min(min, x)
+		}
+		return min
+	}},
+	"max": {Arity: 1, Variadic: true, Fn: func(args []float64) float64 {
+		max := args[0]
+		for _, x := range args[1:] {
+			max = math.Max(max, x)
+		}
+		return max
+	}},
+	// sin is redefined in degrees.
+	"sin": {Arity: 1, Fn: func(args []float64) float64 { return math.Sin(args[0] * math.Pi / 180) }},
+}
+
+func TestRegistry(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		env  Env
+		want string
+	}{
+		{"cos(0) + log(1)", nil, "1"},
+		{"min(3, x, 2)", Env{"x": 1}, "1"},
+		{"max(3, x, 2)", Env{"x": 1}, "3"},
+		{"max(x)", Env{"x": 1}, "1"},
+		{"sin(90) + sqrt(4)", nil, "3"},
+		{"f(x) = x*x+1; f(3)", nil, "10"},
+		{"f(x) = x*x+1; f(3) + x", Env{"x": 1}, "11"},
+		{"f(x) = x*a; f(2)", Env{"a": 5}, "10"},
+		{"f(x, y) = x - y; g(y) = f(y, 1) * y; g(3)", nil, "6"},
+		{"g(y) = a * y; f(a) = g(2) + a; f(3)", Env{"a": 10}, "23"},
+		{"one() = 1; one() + one()", nil, "2"},
+		{"sin(x) = 2*x; sin(3)", nil, "6"},
+		{"fact(n) = n <= 1 ? 1 : n * fact(n-1); fact(5)", nil, "120"},
+		{"f(x) = max(x, 0); f(-2) + f(2)", nil, "2"},
+	} {
+		expr, err := mathFuncs.Parse(test.expr)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got := fmt.Sprintf("%.6g", expr.Eval(test.env))
+		if got != test.want {
+			t.Errorf("%s.Eval() in %v = %q, want %q",
+				test.expr, test.env, got, test.want)
+		}
+
+		// Compiled programs must agree, unless recursive.
+		prog, err := Compile(expr)
+		if err != nil {
+			continue
+		}
+		if got := fmt.Sprintf("%.6g", prog.Run(prog.Slots(test.env))); got != test.want {
+			t.Errorf("%s: Run() in %v = %q, want %q",
+				test.expr, test.env, got, test.want)
+		}
+	}
+}
+
+func TestRegistryErrors(t *testing.T) {
+	for _, test := range []struct{ expr, wantErr string }{
+		{"min()", "call to min has 0 args, want at least 1"},
+		{"cos(1, 2)", "call to cos has 2 args, want 1"},
+		{"tan(1)", `unknown function "tan"`},
+		{"f(x) = x; f(1, 2)", "call to f has 2 args, want 1"},
+		{"f(x) = x; f(x) = 2*x; f(1)", "function f redefined"},
+		{"f(1) = 2; f(1)", "parameter 1 of f is not a variable"},
+		{"f(x, x) = x; f(1, 2)", "duplicate parameter x of f"},
+		{"f(x) = x f(1)", "got identifier f, want ';'"},
+		{"f(x) = tan(x); f(1)", `unknown function "tan"`},
+		{"f(x) = x; 1 + f(1) = 2", "unexpected '='"},
+	} {
+		expr, err := mathFuncs.Parse(test.expr)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+			if err == nil {
+				t.Errorf("unexpected success: %s", test.expr)
+				continue
+			}
+		}
+		if err.Error() != test.wantErr {
+			t.Errorf("%s: got error %s, want %s", test.expr, err, test.wantErr)
+		}
+	}
+
+	// Functions supplied to one call of Parse are not visible to others.
+	expr, err := Parse("cos(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expr.Check(map[Var]bool{}); err == nil {
+		t.Errorf("Parse(cos(0)): Check succeeded, want unknown function")
+	}
+}
+
+func TestFuncVars(t *testing.T) {
+	expr, err := Parse("f(x) = x * a; f(y)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := make(map[Var]bool)
+	if err := expr.Check(vars); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(vars); got != "map[a:true y:true]" {
+		t.Errorf("Check added vars %s, want map[a:true y:true]", got)
+	}
+}
+
+func TestCompileRecursive(t *testing.T) {
+	expr, err := Parse("fact(n) = n <= 1 ? 1 : n * fact(n-1); fact(5)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Compile(expr)
+	if want := "cannot compile recursive function fact"; err == nil || err.Error() != want {
+		t.Errorf("Compile: got error %v, want %s", err, want)
+	}
+}
+
+func TestRegistryCheckEval(t *testing.T) {
+	// Parsed without mathFuncs, the functions are unknown.
+	expr, err := Parse("f(x) = cos(x) + log(x); f(1) + sin(90)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expr.Check(map[Var]bool{}); err == nil {
+		t.Errorf("Check succeeded, want unknown functions")
+	}
+	if err := mathFuncs.Check(expr, map[Var]bool{}); err != nil {
+		t.Fatalf("mathFuncs.Check: %v", err)
+	}
+	// cos(1) + log(1) + sin(90°)
+	if got, err := mathFuncs.Eval(expr, nil); err != nil || got != math.Cos(1)+1 {
+		t.Errorf("mathFuncs.Eval = %g, %v; want %g", got, err, math.Cos(1)+1)
+	}
+
+	// Calls bound by Parse are rebound, here to the Builtins only.
+	expr, err = mathFuncs.Parse("sin(x) + min(x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `unknown function "min"`
+	if err := Registry(nil).Check(expr, map[Var]bool{}); err == nil || err.Error() != want {
+		t.Errorf("Registry(nil).Check: got error %v, want %s", err, want)
+	}
+	expr, err = mathFuncs.Parse("fact(n) = n <= 1 ? 1 : n * fact(n-1); fact(3) + sin(x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Registry(nil).Eval(expr, Env{"x": math.Pi / 2}); err != nil || got != 7 {
+		t.Errorf("Registry(nil).Eval = %g, %v; want 7", got, err)
+	}
+	if got, want := expr.Eval(Env{"x": 90}), 7.0; got != want {
+		t.Errorf("after Registry(nil).Eval, Eval = %g, want %g", got, want)
+	}
+}
+
+func TestDepth(t *testing.T) {
+	for _, input := range []string{
+		"f(x) = f(x); f(1)",
+		"f(x) = 1 + f(x + 1); g(x) = f(x) * 2; g(0)",
+		"count(n) = n > 0 ? 1 + count(n - 1) : 0; count(1e9)",
+	} {
+		expr, err := Parse(input)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		if got, err := Registry(nil).Eval(expr, nil); err != ErrDepth {
+			t.Errorf("Registry(nil).Eval(%s) = %g, %v; want error %v", input, got, err, ErrDepth)
+		}
+		for _, eval := range []func(){
+			func() { expr.Eval(nil) },
+			func() { EvalInterval(expr, nil) },
+			func() { EvalComplex(expr, nil) },
+		} {
+			func() {
+				defer func() {
+					if p := recover(); p != ErrDepth {
+						t.Errorf("%s: got panic %v, want %v", input, p, ErrDepth)
+					}
+				}()
+				eval()
+			}()
+		}
+	}
+
+	// Recursion within the limit succeeds: count(n) makes n+1 calls.
+	expr, err := Parse("count(n) = n > 0 ? 1 + count(n - 1) : 0; count(n)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Registry(nil).Eval(expr, Env{"n": MaxDepth - 1}); err != nil || got != MaxDepth-1 {
+		t.Errorf("count(%d) = %g, %v; want %d", MaxDepth-1, got, err, MaxDepth-1)
+	}
+}
@@ -5,91 +5,290 @@
 //!+
 
 // Chat is a server that lets clients chat with each other.
+//
+// Clients start in the room #lobby.  A line of input that begins
+// with a slash is a command:
+//
+//	/nick name        change nickname
+//	/join #room       leave the current room for another
+//	/msg nick text    send text to one user only
+//	/who              list the users in the current room
+//	/history [n]      show the last n messages in the current room
+//	/quit             disconnect
+//
+// Any other line is sent to everyone in the current room.
+//
+// Each client has a queue of outgoing messages.  If a client reads
+// too slowly and its queue fills, the server disconnects it, or with
+// the -drop flag, discards the messages that do not fit.  Clients
+// that send nothing for the -idle period are disconnected.  On an
+// interrupt, the server notifies the clients and then exits.
+//
+// The server keeps the recent messages of each room, and replays them
+// to clients that enter the room.  With the -histfile flag, it also
+// appends every message to a file, from which it recovers them when
+// restarted.
+//
+// With the -web flag, the server also serves a web page at that
+// address, from which browsers join the same rooms over a WebSocket.
 package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 //!+broadcaster
-type client chan<- string // an outgoing message channel
 
-var (
-	entering = make(chan client)
-	leaving  = make(chan client)
-	messages = make(chan string) // all incoming client messages
-)
+// A client is a connected user.  Apart from out and done, its fields
+// are confined to the broadcaster goroutine, or are set before the
+// client is sent to it.
+type client struct {
+	nick string
+	room string
+	out  chan string   // an outgoing message queue
+	done chan struct{} // closed when the client writer returns
+	conn net.Conn
+
+	dropSlow bool   // when out is full, drop messages instead of disconnecting
+	dropped  int    // number of messages dropped
+	slow     bool   // out was full, and the client must be disconnected
+	reason   string // why the client left, if not by choice
+}
+
+// A message is a line of input from a client.
+type message struct {
+	from *client
+	text string
+}
+
+// A server relays messages among its clients.
+type server struct {
+	entering chan *client
+	leaving  chan *client
+	messages chan message  // all incoming client messages
+	quit     chan struct{} // closed to shut down the server
+	done     chan struct{} // closed when the broadcaster returns
+
+	queueLen int           // capacity of each client's outgoing queue
+	dropSlow bool          // drop messages for slow clients rather than disconnect them
+	idle     time.Duration // disconnect clients idle this long; zero means never
+	grace    time.Duration // time allowed for clients to receive the shutdown notice
+	history  *history      // confined to the broadcaster goroutine
+}
+
+func newServer() *server {
+	return &server{
+		entering: make(chan *client),
+		leaving:  make(chan *client),
+		messages: make(chan message),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+		queueLen: 100,
+		grace:    5 * time.Second,
+		history:  newHistory(20),
+	}
+}
 
-func broadcaster() {
-	clients := make(map[client]bool) // all connected clients
+func (s *server) broadcaster() {
+	clients := make(clients) // all connected clients
 	for {
 		select {
-		case msg := <-messages:
-			// Broadcast incoming message to all
-			// clients' outgoing message channels.
-			for cli := range clients {
-				cli <- msg
+		case msg := <-s.messages:
+			if !clients.has(msg.from) {
+				break // a disconnected client's last words
 			}
+			if msg.text != "" && msg.text[0] == '/' {
+				clients.command(msg.from, msg.text, s.history)
+				break
+			}
+			// Broadcast incoming message to the outgoing message
+			// queues of all clients in the same room.
+			line := msg.from.nick + ": " + msg.text
+			s.history.add(msg.from.room, line)
+			clients.broadcast(msg.from.room, line, nil)
+
+		case cli := <-s.entering:
+			cli.nick = clients.uniqueNick(cli.nick)
+			cli.room = lobby
+			clients[cli.nick] = cli
+			cli.send("You are " + cli.nick + " in " + cli.room)
+			cli.replay(s.history, s.history.size)
+			clients.broadcast(cli.room, cli.nick+" has arrived", cli)
 
-		case cli := <-entering:
-			clients[cli] = true
+		case cli := <-s.leaving:
+			if clients.has(cli) {
+				if cli.reason != "" {
+					cli.send("Disconnected: " + cli.reason)
+				}
+				clients.remove(cli)
+			}
 
-		case cli := <-leaving:
-			delete(clients, cli)
-			close(cli)
+		case <-s.quit:
+			for _, cli := range clients {
+				cli.send("Server is shutting down")
+				close(cli.out)
+				cli.conn.SetWriteDeadline(time.Now().Add(s.grace))
+			}
+			for _, cli := range clients {
+				<-cli.done
+			}
+			s.history.close()
+			close(s.done)
+			return
 		}
+		clients.disconnectSlow()
 	}
 }
 
+// shutdown notifies all clients and disconnects them,
+// then stops the broadcaster.
+func (s *server) shutdown() {
+	close(s.quit)
+	<-s.done
+}
+
 //!-broadcaster
 
 //!+handleConn
-func handleConn(conn net.Conn) {
-	ch := make(chan string) // outgoing client messages
-	go clientWriter(conn, ch)
+func (s *server) handleConn(conn net.Conn) {
+	cli := &client{
+		nick:     conn.RemoteAddr().String(),
+		out:      make(chan string, s.queueLen),
+		done:     make(chan struct{}),
+		conn:     conn,
+		dropSlow: s.dropSlow,
+	}
+	go func() {
+		clientWriter(conn, cli.out)
+		close(cli.done)
+	}()
 
-	who := conn.RemoteAddr().String()
-	ch <- "You are " + who
-	messages <- who + " has arrived"
-	entering <- ch
+	select {
+	case s.entering <- cli:
+	case <-s.done:
+		conn.Close()
+		return
+	}
 
 	input := bufio.NewScanner(conn)
-	for input.Scan() {
-		messages <- who + ": " + input.Text()
+	for {
+		if s.idle > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.idle))
+		}
+		if !input.Scan() || input.Text() == "/quit" {
+			break
+		}
+		select {
+		case s.messages <- message{cli, input.Text()}:
+		case <-s.done:
+		}
+	}
+	if err, ok := input.Err().(net.Error); ok && err.Timeout() {
+		cli.reason = "idle timeout"
 	}
-	// NOTE: ignoring potential errors from input.Err()
 
-	leaving <- ch
-	messages <- who + " has left"
+	select {
+	case s.leaving <- cli:
+	case <-s.done:
+	}
+	<-cli.done // wait for the outgoing messages to be written
 	conn.Close()
 }
 
+// clientWriter writes the messages from ch to conn until ch is closed
+// or a write fails, then closes conn.
 func clientWriter(conn net.Conn, ch <-chan string) {
 	for msg := range ch {
-		fmt.Fprintln(conn, msg) // NOTE: ignoring network errors
+		if _, err := fmt.Fprintln(conn, msg); err != nil {
+			break
+		}
 	}
+	conn.Close()
 }
 
 //!-handleConn
 
+var (
+	addr     = flag.String("addr", "localhost:8000", "listen address")
+	queueLen = flag.Int("queue", 100, "maximum number of messages queued for each client")
+	dropSlow = flag.Bool("drop", false, "drop messages for slow clients instead of disconnecting them")
+	idle     = flag.Duration("idle", 10*time.Minute, "disconnect clients idle for this long (0 means never)")
+	histLen  = flag.Int("history", 20, "number of recent messages kept for each room (less than -queue)")
+	histFile = flag.String("histfile", "", "file in which to keep the history of all rooms")
+	web      = flag.String("web", "localhost:8080", "address of the web client (empty means none)")
+)
+
 //!+main
 func main() {
-	listener, err := net.Listen("tcp", "localhost:8000")
+	flag.Parse()
+	if *queueLen < 1 {
+		log.Fatal("-queue must be positive")
+	}
+	if *histLen < 0 || *histLen >= *queueLen {
+		log.Fatal("-history must be non-negative and less than -queue")
+	}
+	history := newHistory(*histLen)
+	if *histFile != "" {
+		var err error
+		history, err = openHistory(*histFile, *histLen)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	listener, err := net.Listen("tcp", *addr)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	go broadcaster()
+	s := newServer()
+	s.queueLen, s.dropSlow, s.idle, s.history = *queueLen, *dropSlow, *idle, history
+	go s.broadcaster()
+
+	var webServer *http.Server
+	if *web != "" {
+		webServer = &http.Server{Addr: *web, Handler: s.webHandler()}
+		go func() {
+			if err := webServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	// On an interrupt, stop accepting connections and shut down.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	stopping := make(chan struct{})
+	go func() {
+		<-interrupt
+		close(stopping)
+		listener.Close()
+		if webServer != nil {
+			webServer.Close() // WebSockets are closed by shutdown
+		}
+	}()
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			select {
+			case <-stopping:
+				s.shutdown()
+				return
+			default:
+			}
 			log.Print(err)
 			continue
 		}
-		go handleConn(conn)
+		go s.handleConn(conn)
 	}
 }
 
@@ -0,0 +1,432 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer() *server {
+	s := newServer()
+	go s.broadcaster()
+	return s
+}
+
+// A testClient is the far end of a connection to a server.
+type testClient struct {
+	t     *testing.T
+	conn  net.Conn
+	lines chan string // lines received; closed at EOF
+}
+
+// dial connects a new client to s, and reads its greeting.
+func dial(t *testing.T, s *server) *testClient {
+	t.Helper()
+	server, conn := net.Pipe()
+	go s.handleConn(server)
+	c := &testClient{t, conn, make(chan string, 100)}
+	go func() {
+		input := bufio.NewScanner(conn)
+		for input.Scan() {
+			c.lines <- input.Text()
+		}
+		close(c.lines)
+	}()
+	c.next()
+	return c
+}
+
+func (c *testClient) send(format string, args ...interface{}) {
+	c.t.Helper()
+	if _, err := fmt.Fprintf(c.conn, format+"\n", args...); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// next returns the next line received, or "EOF".
+func (c *testClient) next() string {
+	c.t.Helper()
+	select {
+	case line, ok := <-c.lines:
+		if !ok {
+			return "EOF"
+		}
+		return line
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for a line")
+		return ""
+	}
+}
+
+// expect checks that the next lines received are want.
+func (c *testClient) expect(want ...string) {
+	c.t.Helper()
+	for _, w := range want {
+		if got := c.next(); got != w {
+			c.t.Errorf("got %q, want %q", got, w)
+		}
+	}
+}
+
+// named connects a new client to s with the given nickname.
+func named(t *testing.T, s *server, nick string) *testClient {
+	t.Helper()
+	c := dial(t, s)
+	c.send("/nick %s", nick)
+	c.next() // "... is now known as nick"
+	return c
+}
+
+func TestNick(t *testing.T) {
+	s := newTestServer()
+	a := dial(t, s)
+	b := dial(t, s)
+	a.expect("pipe-2 has arrived")
+
+	a.send("/nick alice")
+	a.expect("pipe is now known as alice")
+	b.expect("pipe is now known as alice")
+
+	b.send("/nick alice")
+	b.expect("nickname alice is taken")
+	b.send("/nick al ice")
+	b.expect("usage: /nick name")
+	b.send("/nick")
+	b.expect("usage: /nick name")
+	a.send("/nick alice")
+	a.expect("You are alice")
+
+	// A nickname is free once its user has changed it or left.
+	a.send("/nick ally")
+	a.expect("alice is now known as ally")
+	b.expect("alice is now known as ally")
+	b.send("/nick alice")
+	b.expect("pipe-2 is now known as alice")
+	a.expect("pipe-2 is now known as alice")
+	a.send("/quit")
+	a.expect("EOF")
+	b.expect("ally has left")
+	c := dial(t, s)
+	c.send("/nick ally")
+	c.expect("pipe is now known as ally")
+}
+
+func TestRooms(t *testing.T) {
+	s := newTestServer()
+	alice := named(t, s, "alice")
+	bob := named(t, s, "bob")
+	alice.expect("pipe has arrived", "pipe is now known as bob")
+	carol := named(t, s, "carol")
+	alice.expect("pipe has arrived", "pipe is now known as carol")
+	bob.expect("pipe has arrived", "pipe is now known as carol")
+
+	bob.send("/join #go")
+	bob.expect("You are in #go")
+	alice.expect("bob has left")
+	carol.expect("bob has left")
+	carol.send("/join #go")
+	carol.expect("You are in #go")
+	alice.expect("carol has left")
+	bob.expect("carol has arrived")
+
+	bob.send("hello, gophers")
+	bob.expect("bob: hello, gophers")
+	carol.expect("bob: hello, gophers")
+	alice.send("anyone?")
+	alice.expect("alice: anyone?")
+
+	carol.send("/who")
+	carol.expect("#go: bob carol")
+	alice.send("/who")
+	alice.expect("#lobby: alice")
+
+	bob.send("/join go")
+	bob.expect("usage: /join #room")
+	bob.send("/join #go")
+	bob.expect("You are in #go")
+}
+
+func TestMsg(t *testing.T) {
+	s := newTestServer()
+	alice := named(t, s, "alice")
+	bob := named(t, s, "bob")
+	alice.expect("pipe has arrived", "pipe is now known as bob")
+	bob.send("/join #elsewhere")
+	bob.expect("You are in #elsewhere")
+	alice.expect("bob has left")
+
+	alice.send("/msg bob  psst, bob ")
+	bob.expect("alice (privately): psst, bob")
+	alice.send("/msg dave hi")
+	alice.expect("no such user: dave")
+	alice.send("/msg bob")
+	alice.expect("usage: /msg nick text")
+	alice.send("/shout hi")
+	alice.expect("unknown command /shout; try /nick, /join, /msg, /who, /history or /quit")
+}
+
+func TestQuit(t *testing.T) {
+	s := newTestServer()
+	alice := named(t, s, "alice")
+	bob := named(t, s, "bob")
+	alice.expect("pipe has arrived", "pipe is now known as bob")
+
+	bob.send("/quit")
+	bob.expect("EOF")
+	alice.expect("bob has left")
+	alice.send("/who")
+	alice.expect("#lobby: alice")
+
+	// Closing the connection is like /quit.
+	carol := named(t, s, "carol")
+	alice.expect("pipe has arrived", "pipe is now known as carol")
+	alice.conn.Close()
+	carol.expect("alice has left")
+	carol.send("/who")
+	carol.expect("#lobby: carol")
+}
+
+// dialStalled connects a client to s that sends /nick but never reads.
+func dialStalled(t *testing.T, s *server, nick string) net.Conn {
+	server, conn := net.Pipe()
+	go s.handleConn(server)
+	if _, err := fmt.Fprintf(conn, "/nick %s\n", nick); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// chatter has alice send n messages, waiting for each to reach both
+// alice and bob, and checks that they also receive the extra lines.
+func chatter(t *testing.T, alice, bob *testClient, n int, extra ...string) {
+	t.Helper()
+	want := make(map[*testClient]map[string]bool)
+	for _, c := range []*testClient{alice, bob} {
+		want[c] = make(map[string]bool)
+		for _, line := range extra {
+			want[c][line] = true
+		}
+	}
+	for i := 0; i < n; i++ {
+		msg := fmt.Sprintf("message %d", i)
+		alice.send(msg)
+		for _, c := range []*testClient{alice, bob} {
+			for line := c.next(); line != "alice: "+msg; line = c.next() {
+				if !want[c][line] {
+					t.Fatalf("got %q, want %q", line, "alice: "+msg)
+				}
+				delete(want[c], line)
+			}
+		}
+	}
+	for c, lines := range want {
+		for line := range lines {
+			t.Errorf("%p: did not receive %q", c, line)
+		}
+	}
+}
+
+// TestStalledClient checks that a client that stops reading is
+// disconnected without delaying the others.
+func TestStalledClient(t *testing.T) {
+	s := newServer()
+	s.queueLen = 4
+	go s.broadcaster()
+	alice := named(t, s, "alice")
+	bob := named(t, s, "bob")
+	alice.expect("pipe has arrived", "pipe is now known as bob")
+	stalled := dialStalled(t, s, "stalled")
+	defer stalled.Close()
+	for _, c := range []*testClient{alice, bob} {
+		c.expect("pipe has arrived", "pipe is now known as stalled")
+	}
+
+	chatter(t, alice, bob, 20, "stalled has left (too slow)")
+	alice.send("/who")
+	alice.expect("#lobby: alice bob")
+}
+
+// TestStalledClientDrop checks that a client that stops reading
+// misses messages without delaying the others.
+func TestStalledClientDrop(t *testing.T) {
+	s := newServer()
+	s.queueLen, s.dropSlow = 4, true
+	go s.broadcaster()
+	alice := named(t, s, "alice")
+	bob := named(t, s, "bob")
+	alice.expect("pipe has arrived", "pipe is now known as bob")
+	stalled := dialStalled(t, s, "stalled")
+	for _, c := range []*testClient{alice, bob} {
+		c.expect("pipe has arrived", "pipe is now known as stalled")
+	}
+
+	chatter(t, alice, bob, 20)
+	alice.send("/who")
+	alice.expect("#lobby: alice bob stalled")
+
+	// Once it reads again, the client learns what it missed.
+	lines := make(chan string)
+	go func() {
+		input := bufio.NewScanner(stalled)
+		for input.Scan() {
+			lines <- input.Text()
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		<-lines // the greeting and the first messages
+	}
+	alice.send("last")
+	alice.expect("alice: last")
+	if line := <-lines; !strings.HasSuffix(line, " messages dropped)") {
+		t.Errorf("got %q, want notice of dropped messages", line)
+	}
+	if line := <-lines; line != "alice: last" {
+		t.Errorf("got %q, want %q", line, "alice: last")
+	}
+}
+
+func TestIdle(t *testing.T) {
+	s := newServer()
+	s.idle = 200 * time.Millisecond
+	go s.broadcaster()
+	idler := named(t, s, "idler")
+	other := named(t, s, "other")
+	idler.expect("pipe has arrived", "pipe is now known as other")
+	time.Sleep(s.idle / 2)
+	other.send("/who") // postpones the timeout of other
+	other.expect("#lobby: idler other")
+
+	idler.expect("Disconnected: idle timeout", "EOF")
+	other.expect("idler has left (idle timeout)", "Disconnected: idle timeout", "EOF")
+}
+
+func TestShutdown(t *testing.T) {
+	s := newServer()
+	s.grace = 100 * time.Millisecond
+	go s.broadcaster()
+	alice := named(t, s, "alice")
+	bob := named(t, s, "bob")
+	alice.expect("pipe has arrived", "pipe is now known as bob")
+	stalled := dialStalled(t, s, "stalled")
+	defer stalled.Close()
+	alice.expect("pipe has arrived", "pipe is now known as stalled")
+	bob.expect("pipe has arrived", "pipe is now known as stalled")
+
+	s.shutdown()
+	alice.expect("Server is shutting down", "EOF")
+	bob.expect("Server is shutting down", "EOF")
+
+	// The server closes new connections.
+	if c := dial(t, s); c.next() != "EOF" {
+		t.Error("connection after shutdown was not closed")
+	}
+}
+
+func TestRing(t *testing.T) {
+	r := &ring{lines: make([]string, 3)}
+	for i, want := range []string{"[]", "[a]", "[a b]", "[a b c]", "[b c d]", "[c d e]"} {
+		if got := fmt.Sprint(r.last(5)); got != want {
+			t.Errorf("after %d adds, last(5) = %s, want %s", i, got, want)
+		}
+		r.add(string(rune('a' + i)))
+	}
+	if got := fmt.Sprint(r.last(2)); got != "[e f]" {
+		t.Errorf("last(2) = %s, want [e f]", got)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	s := newServer()
+	s.history = newHistory(3)
+	go s.broadcaster()
+	alice := named(t, s, "alice")
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		alice.send(msg)
+		alice.expect("alice: " + msg)
+	}
+
+	bob := dial(t, s) // reads the greeting
+	bob.expect("alice: two", "alice: three", "alice: four")
+	alice.expect("pipe has arrived")
+	bob.send("/history 2")
+	bob.expect("alice: three", "alice: four")
+	bob.send("/history")
+	bob.expect("alice: two", "alice: three", "alice: four")
+	bob.send("/history many")
+	bob.expect("usage: /history [n]")
+
+	// Each room has its own history.
+	bob.send("/join #go")
+	bob.expect("You are in #go")
+	alice.expect("pipe has left")
+	bob.send("hello")
+	bob.expect("pipe: hello")
+	bob.send("/history 10")
+	bob.expect("pipe: hello")
+	alice.send("/join #go")
+	alice.expect("You are in #go", "pipe: hello")
+	bob.expect("alice has arrived")
+}
+
+func TestHistoryFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history")
+	h, err := openHistory(filename, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer()
+	s.history = h
+	go s.broadcaster()
+	alice := named(t, s, "alice")
+	for _, msg := range []string{"one", "two", "three"} {
+		alice.send(msg)
+		alice.expect("alice: " + msg)
+	}
+	alice.send("/join #go")
+	alice.expect("You are in #go")
+	alice.send("four")
+	alice.expect("alice: four")
+	s.shutdown()
+
+	// Simulate a crash in the middle of writing a line.
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("#go\talice: fi")
+	f.Close()
+
+	// The history survives a restart.
+	h, err = openHistory(filename, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = newServer()
+	s.history = h
+	go s.broadcaster()
+	defer s.shutdown()
+	bob := dial(t, s)
+	bob.expect("alice: two", "alice: three")
+	bob.send("/join #go")
+	bob.expect("You are in #go", "alice: four")
+	bob.send("five")
+	bob.expect("pipe: five")
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "#lobby\talice: one\n#lobby\talice: two\n#lobby\talice: three\n" +
+		"#go\talice: four\n#go\tpipe: five\n"
+	if string(data) != want {
+		t.Errorf("history file contains %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// lobby is the room in which clients start.
+const lobby = "#lobby"
+
+// clients maps the nickname of each connected client to the client.
+// It is confined to the broadcaster goroutine.
+type clients map[string]*client
+
+// send queues msg for the client, if there is room.  If not, the
+// message is dropped, and unless cli.dropSlow, the client is marked
+// for disconnection.  Once there is room again, a dropSlow client
+// is told how many messages it missed.
+func (cli *client) send(msg string) {
+	// Only the broadcaster sends to out, so the room can only grow.
+	if cli.dropped > 0 && cap(cli.out)-len(cli.out) >= 2 {
+		cli.out <- fmt.Sprintf("(%d messages dropped)", cli.dropped)
+		cli.dropped = 0
+	}
+	select {
+	case cli.out <- msg:
+	default:
+		cli.dropped++
+		if !cli.dropSlow {
+			cli.slow = true
+		}
+	}
+}
+
+// broadcast sends msg to each client in room except the one specified.
+func (cs clients) broadcast(room, msg string, except *client) {
+	for _, cli := range cs {
+		if cli.room == room && cli != except {
+			cli.send(msg)
+		}
+	}
+}
+
+// has reports whether cli is connected.
+func (cs clients) has(cli *client) bool { return cs[cli.nick] == cli }
+
+// remove disconnects cli and tells the others in its room.
+func (cs clients) remove(cli *client) {
+	delete(cs, cli.nick)
+	close(cli.out)
+	msg := cli.nick + " has left"
+	if cli.reason != "" {
+		msg += " (" + cli.reason + ")"
+	}
+	cs.broadcast(cli.room, msg, nil)
+}
+
+// disconnectSlow disconnects the clients whose queues overflowed,
+// including those that overflow with the news of it.
+func (cs clients) disconnectSlow() {
+	for done := false; !done; {
+		done = true
+		for _, cli := range cs {
+			if cli.slow {
+				cli.reason = "too slow"
+				cs.remove(cli)
+				cli.conn.Close() // unblock the client writer
+				done = false
+			}
+		}
+	}
+}
+
+// uniqueNick returns nick, if it is not taken, or else nick with
+// the smallest numeric suffix that is not taken.
+func (cs clients) uniqueNick(nick string) string {
+	if cs[nick] == nil {
+		return nick
+	}
+	for i := 2; ; i++ {
+		if s := fmt.Sprintf("%s-%d", nick, i); cs[s] == nil {
+			return s
+		}
+	}
+}
+
+// replay sends the last n messages of the client's room to the client.
+func (cli *client) replay(h *history, n int) {
+	for _, msg := range h.recent(cli.room, n) {
+		cli.send(msg)
+	}
+}
+
+// command executes the command line from client cli.
+func (cs clients) command(cli *client, line string, h *history) {
+	cmd, arg := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	switch cmd {
+	case "/nick":
+		switch {
+		case !isName(arg):
+			cli.send("usage: /nick name")
+		case cs[arg] == cli:
+			cli.send("You are " + arg)
+		case cs[arg] != nil:
+			cli.send("nickname " + arg + " is taken")
+		default:
+			old := cli.nick
+			delete(cs, old)
+			cli.nick = arg
+			cs[arg] = cli
+			cs.broadcast(cli.room, old+" is now known as "+arg, nil)
+		}
+
+	case "/join":
+		switch {
+		case !strings.HasPrefix(arg, "#") || !isName(arg[1:]):
+			cli.send("usage: /join #room")
+		case arg == cli.room:
+			cli.send("You are in " + arg)
+		default:
+			cs.broadcast(cli.room, cli.nick+" has left", cli)
+			cli.room = arg
+			cli.send("You are in " + arg)
+			cli.replay(h, h.size)
+			cs.broadcast(cli.room, cli.nick+" has arrived", cli)
+		}
+
+	case "/msg":
+		to, text := arg, ""
+		if i := strings.IndexByte(arg, ' '); i >= 0 {
+			to, text = arg[:i], strings.TrimSpace(arg[i+1:])
+		}
+		if text == "" {
+			cli.send("usage: /msg nick text")
+		} else if recipient := cs[to]; recipient == nil {
+			cli.send("no such user: " + to)
+		} else {
+			recipient.send(cli.nick + " (privately): " + text)
+		}
+
+	case "/who":
+		var nicks []string
+		for nick, c := range cs {
+			if c.room == cli.room {
+				nicks = append(nicks, nick)
+			}
+		}
+		sort.Strings(nicks)
+		cli.send(cli.room + ": " + strings.Join(nicks, " "))
+
+	case "/history":
+		n, err := strconv.Atoi(arg)
+		if arg == "" {
+			n, err = h.size, nil
+		}
+		if err != nil || n < 0 {
+			cli.send("usage: /history [n]")
+		} else {
+			cli.replay(h, n)
+		}
+
+	default:
+		cli.send("unknown command " + cmd + "; try /nick, /join, /msg, /who, /history or /quit")
+	}
+}
+
+// isName reports whether s is a valid nickname or room name:
+// letters, digits, and the punctuation "-_.", at most 32 bytes.
+func isName(s string) bool {
+	if s == "" || len(s) > 32 {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_.", r) {
+			return false
+		}
+	}
+	return true
+}
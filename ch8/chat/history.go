@@ -0,0 +1,123 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// A history holds the recent messages of each room.
+// It is confined to the broadcaster goroutine.
+type history struct {
+	size  int              // number of messages kept per room
+	rooms map[string]*ring // recent messages, by room
+	file  *os.File         // if non-nil, where messages are appended
+}
+
+// newHistory returns a history that keeps size messages per room
+// in memory only.
+func newHistory(size int) *history {
+	return &history{size: size, rooms: make(map[string]*ring)}
+}
+
+// openHistory returns a history that keeps size messages per room,
+// and that also appends them to the named file.  It reads the recent
+// messages from the file, if it exists.
+//
+// Each line of the file is a room name and a message, separated by a
+// tab.  A final line without a newline, left by a crash, is ignored.
+func openHistory(filename string, size int) (*history, error) {
+	h := newHistory(size)
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	in := bufio.NewReader(f)
+	var end int64 // offset of the end of the last complete line
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			break // NOTE: ignoring read errors, and a torn final line
+		}
+		end += int64(len(line))
+		if i := strings.IndexByte(line, '\t'); i > 0 {
+			h.remember(line[:i], line[i+1:len(line)-1])
+		}
+	}
+	if err := f.Truncate(end); err != nil {
+		f.Close()
+		return nil, err
+	}
+	h.file = f
+	return h, nil
+}
+
+// remember adds a message to the recent messages of room.
+func (h *history) remember(room, msg string) {
+	if h.size == 0 {
+		return
+	}
+	r := h.rooms[room]
+	if r == nil {
+		r = &ring{lines: make([]string, h.size)}
+		h.rooms[room] = r
+	}
+	r.add(msg)
+}
+
+// add records a message in room.
+func (h *history) add(room, msg string) {
+	h.remember(room, msg)
+	if h.file != nil {
+		if _, err := fmt.Fprintf(h.file, "%s\t%s\n", room, msg); err != nil {
+			log.Printf("history: %v", err)
+		}
+	}
+}
+
+// recent returns the last n messages of room, or all of them
+// if there are fewer than n.
+func (h *history) recent(room string, n int) []string {
+	if r := h.rooms[room]; r != nil {
+		return r.last(n)
+	}
+	return nil
+}
+
+func (h *history) close() {
+	if h.file != nil {
+		h.file.Close()
+	}
+}
+
+// A ring is a circular buffer of the most recent lines added to it.
+type ring struct {
+	lines []string
+	next  int // index at which to add the next line
+	n     int // number of lines held
+}
+
+func (r *ring) add(line string) {
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.n < len(r.lines) {
+		r.n++
+	}
+}
+
+// last returns the most recent n lines, oldest first.
+func (r *ring) last(n int) []string {
+	if n > r.n {
+		n = r.n
+	}
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = r.lines[(r.next-n+i+len(r.lines))%len(r.lines)]
+	}
+	return lines
+}
@@ -0,0 +1,70 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"io"
+	"net/http"
+)
+
+// webHandler returns a handler that serves the chat page at / and
+// connects WebSockets at /ws to the server as clients.
+func (s *server) webHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, page)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrade(w, req)
+		if err != nil {
+			return // upgrade has replied with the error
+		}
+		s.handleConn(conn)
+	})
+	return mux
+}
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Chat</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+#log { height: 80vh; overflow-y: auto; border: 1px solid #ccc; padding: 0.5em; white-space: pre-wrap; font-family: monospace; }
+#line { width: 100%; box-sizing: border-box; margin-top: 0.5em; }
+</style>
+</head>
+<body>
+<div id="log"></div>
+<form id="form"><input id="line" autocomplete="off" autofocus
+  placeholder="Type a message, or /nick, /join, /msg, /who, /history or /quit"></form>
+<script>
+var log = document.getElementById("log");
+function show(text) {
+	var div = document.createElement("div");
+	div.textContent = text;
+	log.appendChild(div);
+	log.scrollTop = log.scrollHeight;
+}
+var ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+ws.onmessage = function(e) { show(e.data); };
+ws.onclose = function() { show("(disconnected)"); };
+document.getElementById("form").onsubmit = function(e) {
+	e.preventDefault();
+	var line = document.getElementById("line");
+	if (line.value !== "") {
+		ws.send(line.value);
+		line.value = "";
+	}
+};
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,293 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+// This file implements enough of the WebSocket protocol (RFC 6455)
+// for a browser to chat: the opening handshake, text messages,
+// pings, and the closing handshake.  Extensions and subprotocols
+// are not supported.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opcodes of WebSocket frames.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Status codes of close frames.
+const (
+	closeNormal        = 1000
+	closeProtocolError = 1002
+	closeTooBig        = 1009
+)
+
+// maxMessage is the maximum length of a message from a client.
+// A message and the newline that ends it must fit in the buffer
+// of the bufio.Scanner of handleConn.
+const maxMessage = bufio.MaxScanTokenSize - 1
+
+// acceptKey returns the Sec-WebSocket-Accept header value for
+// the client's Sec-WebSocket-Key.
+func acceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+"258EAFA5-E914-47DA-95CA-C5AB0DC85B11")
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContains reports whether the comma-separated list of tokens
+// in header field name of h contains token, ignoring case.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[name] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgrade completes the opening handshake of a WebSocket and returns
+// a connection that reads and writes lines of text as text messages.
+// If the request is not a valid handshake, upgrade replies with an
+// error and returns a non-nil error.
+func upgrade(w http.ResponseWriter, req *http.Request) (net.Conn, error) {
+	fail := func(code int, msg string) (net.Conn, error) {
+		http.Error(w, msg, code)
+		return nil, errors.New(msg)
+	}
+	if req.Method != "GET" {
+		return fail(http.StatusMethodNotAllowed, "websocket: method not GET")
+	}
+	if !headerContains(req.Header, "Connection", "upgrade") ||
+		!headerContains(req.Header, "Upgrade", "websocket") {
+		return fail(http.StatusBadRequest, "websocket: not a websocket handshake")
+	}
+	if req.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return fail(http.StatusBadRequest, "websocket: unsupported version")
+	}
+	key := req.Header.Get("Sec-Websocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		return fail(http.StatusBadRequest, "websocket: bad Sec-WebSocket-Key")
+	}
+	// Refuse pages of other sites, which could otherwise use the
+	// cookies and network position of the browser.
+	if origin := req.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != req.Host {
+			return fail(http.StatusForbidden, "websocket: cross-origin request")
+		}
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return fail(http.StatusInternalServerError, "websocket: connection cannot be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return fail(http.StatusInternalServerError, "websocket: "+err.Error())
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{Conn: conn, r: rw.Reader, sema: make(chan struct{}, 1)}, nil
+}
+
+// A wsConn is the server end of a WebSocket.  Each text message from
+// the client reads as a line, and each Write sends a text message,
+// without its final newline.
+type wsConn struct {
+	net.Conn               // the hijacked connection
+	r        *bufio.Reader // buffered input from Conn
+	buf      []byte        // unread part of the current message
+
+	sema   chan struct{} // a binary semaphore guarding frame writes
+	closed sync.Once
+}
+
+// A protocolError is a violation of the protocol by the client.
+type protocolError struct {
+	status int
+	msg    string
+}
+
+func (e *protocolError) Error() string { return "websocket: " + e.msg }
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		msg, err := c.readMessage()
+		if pe, ok := err.(*protocolError); ok {
+			c.writeClose(pe.status)
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.buf = append(msg, '\n')
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// readMessage returns the payload of the next data message,
+// answering control frames along the way.  It returns io.EOF
+// when the client closes the WebSocket.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	started := false
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opPing:
+			c.writeFrame(opPong, payload)
+		case opPong:
+			// ignore
+		case opClose:
+			status := closeNormal
+			if len(payload) >= 2 {
+				status = int(binary.BigEndian.Uint16(payload))
+			}
+			c.writeClose(status)
+			return nil, io.EOF
+		case opText, opBinary, opContinuation:
+			if started == (op != opContinuation) {
+				return nil, &protocolError{closeProtocolError, "unexpected continuation"}
+			}
+			started = true
+			if len(msg)+len(payload) > maxMessage {
+				return nil, &protocolError{closeTooBig, "message too big"}
+			}
+			msg = append(msg, payload...)
+			if fin {
+				return msg, nil
+			}
+		default:
+			return nil, &protocolError{closeProtocolError, fmt.Sprintf("unknown opcode %d", op)}
+		}
+	}
+}
+
+// readFrame reads a frame from the client and unmasks its payload.
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = header[0]&0x80 != 0, header[0]&0x0F
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &protocolError{closeProtocolError, "reserved bits set"}
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, &protocolError{closeProtocolError, "unmasked client frame"}
+	}
+	n := uint64(header[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= opClose && (!fin || n > 125) {
+		return false, 0, nil, &protocolError{closeProtocolError, "bad control frame"}
+	}
+	if n > maxMessage {
+		return false, 0, nil, &protocolError{closeTooBig, "message too big"}
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opText, bytes.TrimSuffix(p, []byte("\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame sends an unmasked, unfragmented frame to the client.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	frame := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n < 126:
+		frame[1] = byte(n)
+	case n <= 0xFFFF:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	c.sema <- struct{}{} // acquire token
+	_, err := c.Conn.Write(frame)
+	<-c.sema // release token
+	return err
+}
+
+// writeClose sends a close frame with the given status, once.
+func (c *wsConn) writeClose(status int) {
+	c.closed.Do(func() {
+		c.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, uint16(status)))
+	})
+}
+
+// Close closes the WebSocket, sending a close frame unless another
+// frame is being written, which may be stalled.
+func (c *wsConn) Close() error {
+	select {
+	case c.sema <- struct{}{}: // acquire token
+		<-c.sema // release token
+		c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.writeClose(closeNormal)
+	default:
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,256 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// The example of RFC 6455, section 1.3.
+	if got, want := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Errorf("acceptKey = %s, want %s", got, want)
+	}
+}
+
+// A wsClient is a minimal WebSocket client.
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+const testKey = "MDEyMzQ1Njc4OWFiY2RlZg==" // base64 of "0123456789abcdef"
+
+// handshake sends an opening handshake to ts with the extra header
+// lines and returns the response.
+func handshake(t *testing.T, ts *httptest.Server, extra string) (*wsClient, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := ts.Listener.Addr().String()
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\n"+
+		"Host: %s\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\n"+
+		"Sec-WebSocket-Version: 13\r\n"+
+		"%s\r\n", host, testKey, extra)
+	c := &wsClient{t, conn, bufio.NewReader(conn)}
+	resp, err := http.ReadResponse(c.r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, resp
+}
+
+// dialWS opens a WebSocket to ts, as a page from ts would.
+func dialWS(t *testing.T, ts *httptest.Server) *wsClient {
+	t.Helper()
+	c, resp := handshake(t, ts, "Origin: "+ts.URL+"\r\n")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake failed: %s", resp.Status)
+	}
+	if got, want := resp.Header.Get("Sec-WebSocket-Accept"), acceptKey(testKey); got != want {
+		t.Fatalf("Sec-WebSocket-Accept = %q, want %q", got, want)
+	}
+	return c
+}
+
+// writeFrame sends a masked frame.
+func (c *wsClient) writeFrame(fin bool, op byte, payload string) {
+	c.t.Helper()
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{b0, 0x80}
+	switch n := len(payload); {
+	case n < 126:
+		frame[1] |= byte(n)
+	case n <= 0xFFFF:
+		frame[1] |= 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame[1] |= 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, mask...)
+	for i := range payload {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsClient) send(text string) { c.writeFrame(true, opText, text) }
+
+// readFrame reads an unmasked, unfragmented frame.
+func (c *wsClient) readFrame() (op byte, payload string) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		c.t.Fatalf("frame header % x: want final and unmasked", header)
+	}
+	n := int(header[1])
+	switch n {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.r, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.r, ext[:])
+		n = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		c.t.Fatal(err)
+	}
+	return header[0] & 0x0F, string(buf)
+}
+
+// expect checks that the next messages are the text messages want.
+func (c *wsClient) expect(want ...string) {
+	c.t.Helper()
+	for _, w := range want {
+		if op, got := c.readFrame(); op != opText || got != w {
+			c.t.Errorf("got frame %d %q, want text %q", op, got, w)
+		}
+	}
+}
+
+// expectClose checks that the next frame closes with status.
+func (c *wsClient) expectClose(status int) {
+	c.t.Helper()
+	op, payload := c.readFrame()
+	if op != opClose || len(payload) != 2 || int(binary.BigEndian.Uint16([]byte(payload))) != status {
+		c.t.Errorf("got frame %d %q, want close with status %d", op, payload, status)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	s := newTestServer()
+	ts := httptest.NewServer(s.webHandler())
+	defer ts.Close()
+
+	netcat := named(t, s, "netcat")
+	ws := dialWS(t, ts)
+	op, greeting := ws.readFrame()
+	addr := strings.TrimPrefix(greeting, "You are ")
+	addr = strings.TrimSuffix(addr, " in #lobby")
+	if op != opText || !strings.HasPrefix(addr, "127.0.0.1:") {
+		t.Fatalf("got greeting %q", greeting)
+	}
+	netcat.expect(addr + " has arrived")
+
+	ws.send("/nick browser")
+	ws.expect(addr + " is now known as browser")
+	netcat.expect(addr + " is now known as browser")
+
+	netcat.send("hi from netcat")
+	netcat.expect("netcat: hi from netcat")
+	ws.expect("netcat: hi from netcat")
+
+	// A fragmented message, interrupted by a ping.
+	ws.writeFrame(false, opText, "hello, ")
+	ws.writeFrame(true, opPing, "are you there?")
+	ws.writeFrame(true, opContinuation, "netcat")
+	if op, payload := ws.readFrame(); op != opPong || payload != "are you there?" {
+		t.Errorf("got frame %d %q, want pong", op, payload)
+	}
+	ws.expect("browser: hello, netcat")
+	netcat.expect("browser: hello, netcat")
+
+	ws.writeFrame(true, opClose, "\x03\xe8") // 1000
+	ws.expectClose(closeNormal)
+	netcat.expect("browser has left")
+}
+
+func TestWebSocketErrors(t *testing.T) {
+	s := newTestServer()
+	ts := httptest.NewServer(s.webHandler())
+	defer ts.Close()
+
+	for _, test := range []struct {
+		path, header string
+		status       int
+	}{
+		{"/ws", "", http.StatusBadRequest},
+		{"/ws", "Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 8\r\n",
+			http.StatusBadRequest},
+		{"/ws", "Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n" +
+			"Sec-WebSocket-Key: " + testKey + "\r\nOrigin: http://evil.example\r\n", http.StatusForbidden},
+		{"/nonesuch", "", http.StatusNotFound},
+	} {
+		req, _ := http.NewRequest("GET", ts.URL+test.path, nil)
+		for _, line := range strings.Split(strings.TrimSpace(test.header), "\r\n") {
+			if i := strings.Index(line, ": "); i > 0 {
+				req.Header.Set(line[:i], line[i+2:])
+			}
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("GET %s with %q: status %d, want %d", test.path, test.header, resp.StatusCode, test.status)
+		}
+	}
+
+	// The page.
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "new WebSocket(") {
+		t.Errorf("GET / returned %s", body)
+	}
+
+	// A client frame must be masked.
+	ws := dialWS(t, ts)
+	ws.readFrame() // greeting
+	ws.conn.Write([]byte{0x81, 2, 'h', 'i'})
+	ws.expectClose(closeProtocolError)
+
+	// A message longer than the maximum closes the WebSocket,
+	// whether in one frame or several.
+	long := strings.Repeat("x", maxMessage)
+	ws = dialWS(t, ts)
+	ws.readFrame() // greeting
+	ws.writeFrame(false, opText, long)
+	ws.writeFrame(true, opContinuation, "x")
+	ws.expectClose(closeTooBig)
+
+	// A message of the maximum length is delivered.
+	ws = dialWS(t, ts)
+	ws.readFrame() // greeting
+	ws.send(long)
+	if op, got := ws.readFrame(); op != opText || !strings.HasSuffix(got, ": "+long) {
+		t.Errorf("message of %d bytes: got frame %d of %d bytes, want it back",
+			len(long), op, len(got))
+	}
+	ws.send(long + "x")
+	ws.expectClose(closeTooBig)
+}
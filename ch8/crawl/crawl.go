@@ -0,0 +1,264 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Package crawl provides a polite web crawler with bounded parallelism.
+//
+// A crawl starts from a list of seed URLs and follows the links in
+// each HTML page it fetches, optionally only to a maximum depth and
+// only within the hosts of the seeds.  It obeys the robots.txt file
+// of each host, which it fetches once, and limits both the number of
+// concurrent requests to each host and the rate at which it sends them.
+// Unlike crawl3, a crawl ends when no links remain to be followed.
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDisallowed is the error of a page that the robots.txt file
+// of its host forbids the crawler to fetch.
+var ErrDisallowed = errors.New("crawl: disallowed by robots.txt")
+
+// A Page is the result of fetching a URL.
+type Page struct {
+	URL   string   // the URL, without fragment
+	Depth int      // the number of links followed from a seed
+	Links []string // the absolute URLs of the links in the page
+	Err   error    // the error, if the page could not be fetched
+}
+
+// Options configures a crawl.  The zero value follows all links,
+// one request at a time to each host.
+type Options struct {
+	// MaxDepth is the maximum number of links followed from a seed.
+	// Zero means no limit, and a negative value means that no links
+	// are followed: only the seeds are fetched.
+	MaxDepth int
+
+	// SameDomain restricts the crawl to the hosts of the seeds.
+	// A host is a name or address and a port.
+	SameDomain bool
+
+	// Workers is the maximum number of concurrent requests to all
+	// hosts.  Zero means 20.  A link waits for the limits of its host
+	// before taking one of these, so a slow host delays only its own.
+	Workers int
+
+	// PerHost is the maximum number of concurrent requests to each
+	// host.  Zero means 1.
+	PerHost int
+
+	// Delay is the minimum time between the starts of requests to
+	// the same host.  A longer Crawl-delay in robots.txt prevails.
+	Delay time.Duration
+
+	// UserAgent identifies the crawler to servers, and selects its
+	// rules in robots.txt.  The default is "gopl-crawl".
+	UserAgent string
+
+	// Client sends the requests.  Nil means http.DefaultClient.
+	// The crawler follows redirects itself, as links, so that the
+	// targets are subject to the same limits.
+	Client *http.Client
+
+	// Extract returns the links in an HTML document, which are
+	// resolved relative to the URL of the page.  The default scans
+	// for the href attributes of <a> and <area> elements.
+	Extract func(doc io.Reader) ([]string, error)
+}
+
+// A link is a URL to be fetched.
+type link struct {
+	url   *url.URL
+	depth int
+}
+
+// A crawler holds the state of a crawl shared by its workers.
+type crawler struct {
+	Options
+	pages  *http.Client  // Client, but not following redirects
+	tokens chan struct{} // a counting semaphore limiting all requests
+
+	mu    sync.Mutex
+	hosts map[string]*host // keyed by scheme and host
+}
+
+// Crawl crawls the web from the seed URLs with the default options.
+func Crawl(ctx context.Context, seeds []string, visit func(*Page)) error {
+	return Options{}.Crawl(ctx, seeds, visit)
+}
+
+// Crawl crawls the web from the seed URLs, calling visit for each
+// page that it fetches or that robots.txt forbids it to fetch.
+// Calls of visit are sequential.  Crawl returns nil when no links
+// remain to be followed, or the error of ctx if it is done first.
+func (o Options) Crawl(ctx context.Context, seeds []string, visit func(*Page)) error {
+	if o.Workers <= 0 {
+		o.Workers = 20
+	}
+	if o.PerHost <= 0 {
+		o.PerHost = 1
+	}
+	if o.UserAgent == "" {
+		o.UserAgent = "gopl-crawl"
+	}
+	if o.Client == nil {
+		o.Client = http.DefaultClient
+	}
+	if o.Extract == nil {
+		o.Extract = extractLinks
+	}
+	pages := *o.Client
+	pages.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	c := &crawler{
+		Options: o,
+		pages:   &pages,
+		tokens:  make(chan struct{}, o.Workers),
+		hosts:   make(map[string]*host),
+	}
+
+	// Each link is fetched by its own goroutine, which waits for
+	// the limits of its host and then for a token of c.tokens.
+	workCtx, cancel := context.WithCancel(ctx)
+	results := make(chan *Page)
+	pending := 0 // links being fetched whose pages are not yet received
+	fetch := func(l link) {
+		pending++
+		go func() { results <- c.fetch(workCtx, l) }()
+	}
+	defer func() {
+		// Stop the fetches and discard their unfinished pages.
+		cancel()
+		for ; pending > 0; pending-- {
+			<-results
+		}
+	}()
+
+	seen := make(map[string]bool)  // URLs ever fetched
+	sites := make(map[string]bool) // hosts of the seeds
+	for _, seed := range seeds {
+		u, err := parseLink(nil, seed)
+		if err != nil {
+			visit(&Page{URL: seed, Err: err})
+			continue
+		}
+		sites[u.Host] = true
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			fetch(link{u, 0})
+		}
+	}
+
+	// The crawl ends when no fetch remains that may yield more links.
+	for pending > 0 {
+		if err := ctx.Err(); err != nil {
+			return err // perhaps cancelled by visit
+		}
+		select {
+		case p := <-results:
+			pending--
+			visit(p)
+			if o.MaxDepth < 0 || o.MaxDepth > 0 && p.Depth >= o.MaxDepth {
+				break
+			}
+			for _, s := range p.Links {
+				u, err := url.Parse(s)
+				if err != nil || o.SameDomain && !sites[u.Host] || seen[s] {
+					continue
+				}
+				seen[s] = true
+				fetch(link{u, p.Depth + 1})
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// fetch fetches the page at l, subject to the rules and limits
+// of its host.
+func (c *crawler) fetch(ctx context.Context, l link) *Page {
+	p := &Page{URL: l.url.String(), Depth: l.depth}
+	h, err := c.host(ctx, l.url)
+	if err != nil {
+		p.Err = err
+		return p
+	}
+	if !h.robots.allowed(l.url.RequestURI()) {
+		p.Err = ErrDisallowed
+		return p
+	}
+	release, err := c.acquire(ctx, h, h.delay)
+	if err != nil {
+		p.Err = err
+		return p
+	}
+	defer release()
+	p.Links, p.Err = c.get(ctx, l.url)
+	return p
+}
+
+// get sends a GET request for u and returns the links in the
+// response: those in an HTML page, or the target of a redirect.
+func (c *crawler) get(ctx context.Context, u *url.URL) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	resp, err := c.pages.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var hrefs []string
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != "":
+		hrefs = []string{resp.Header.Get("Location")}
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("getting %s: %s", u, resp.Status)
+	case strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html"):
+		hrefs, err = c.Extract(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s as HTML: %v", u, err)
+		}
+	}
+
+	var links []string
+	for _, href := range hrefs {
+		if link, err := parseLink(u, href); err == nil {
+			links = append(links, link.String())
+		}
+	}
+	return links, nil
+}
+
+// parseLink parses href relative to base, if not nil, and returns
+// the resulting URL without its fragment.  Only http and https URLs
+// are accepted.
+func parseLink(base *url.URL, href string) (*url.URL, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("crawl: %q is not an http or https URL", href)
+	}
+	u.Fragment, u.RawFragment = "", ""
+	return u, nil
+}
@@ -0,0 +1,392 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package crawl_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopl.io/ch8/crawl"
+)
+
+// A site is a test web site whose pages are given by a map from
+// path to HTML.  It records the requests it serves.
+type site struct {
+	pages  map[string]string
+	robots string        // the robots.txt file; empty means none
+	serve  time.Duration // the time taken to serve each page
+
+	mu        sync.Mutex
+	paths     []string    // the paths requested, in order
+	times     []time.Time // the times of the requests
+	active    int         // the number of requests being served
+	maxActive int
+}
+
+func (s *site) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.paths = append(s.paths, req.URL.Path)
+	s.times = append(s.times, time.Now())
+	s.active++
+	if s.active > s.maxActive {
+		s.maxActive = s.active
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}()
+
+	if req.URL.Path == "/robots.txt" && s.robots != "" {
+		fmt.Fprint(w, s.robots)
+		return
+	}
+	page, ok := s.pages[req.URL.Path]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	time.Sleep(s.serve)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, page)
+}
+
+// requested returns the sorted paths requested from s, less robots.txt.
+func (s *site) requested() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for _, p := range s.paths {
+		if p != "/robots.txt" {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// count returns the number of requests for path.
+func (s *site) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, p := range s.paths {
+		if p == path {
+			n++
+		}
+	}
+	return n
+}
+
+// log returns the times of the requests, and the maximum number
+// served concurrently.
+func (s *site) log() (times []time.Time, maxActive int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time(nil), s.times...), s.maxActive
+}
+
+// reset forgets the requests.
+func (s *site) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths, s.times, s.maxActive = nil, nil, 0
+}
+
+// start starts a server for s, stopped at the end of the test.
+func start(t *testing.T, s *site) *httptest.Server {
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// crawlAll crawls from seed, and returns the visited pages
+// keyed by URL less the prefix of the seed's server.
+func crawlAll(t *testing.T, o crawl.Options, ts *httptest.Server, seed string) map[string]*crawl.Page {
+	t.Helper()
+	pages := make(map[string]*crawl.Page)
+	err := o.Crawl(context.Background(), []string{ts.URL + seed}, func(p *crawl.Page) {
+		path := strings.TrimPrefix(p.URL, ts.URL)
+		if pages[path] != nil {
+			t.Errorf("%s visited twice", p.URL)
+		}
+		pages[path] = p
+	})
+	if err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+	return pages
+}
+
+func keys(m map[string]*crawl.Page) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCrawl(t *testing.T) {
+	s := &site{pages: map[string]string{
+		"/":  `<a href="a">A</a> <a href='/b#top'>B</a> <a href="mailto:x@example.com">mail</a>`,
+		"/a": `<!-- <a href="/hidden"> --> <A HREF=c>C</A> <a href="/">home</a>`,
+		"/b": `<a href="/a">A</a> <a href="/missing">?</a>`,
+		"/c": `<p>no links</p>`,
+	}}
+	ts := start(t, s)
+	pages := crawlAll(t, crawl.Options{}, ts, "/")
+
+	want := []string{"/", "/a", "/b", "/c", "/missing"}
+	if got := keys(pages); !reflect.DeepEqual(got, want) {
+		t.Errorf("visited %v, want %v", got, want)
+	}
+	if got := s.requested(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requested %v, want %v", got, want)
+	}
+	for path, depth := range map[string]int{"/": 0, "/a": 1, "/b": 1, "/c": 2, "/missing": 2} {
+		if p := pages[path]; p != nil && p.Depth != depth {
+			t.Errorf("%s: depth %d, want %d", path, p.Depth, depth)
+		}
+	}
+	if p := pages["/missing"]; p != nil && p.Err == nil {
+		t.Errorf("/missing: no error")
+	}
+	wantLinks := []string{ts.URL + "/a", ts.URL + "/b"}
+	if p := pages["/"]; p != nil && !reflect.DeepEqual(p.Links, wantLinks) {
+		t.Errorf("/: links %v, want %v", p.Links, wantLinks)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	s := &site{pages: map[string]string{
+		"/0": `<a href="/1">`,
+		"/1": `<a href="/2">`,
+		"/2": `<a href="/3">`,
+		"/3": `<a href="/0">`,
+	}}
+	ts := start(t, s)
+	crawlAll(t, crawl.Options{MaxDepth: 2}, ts, "/0")
+	if got, want := s.requested(), []string{"/0", "/1", "/2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requested %v, want %v", got, want)
+	}
+
+	// A negative MaxDepth fetches only the seeds.
+	s.reset()
+	crawlAll(t, crawl.Options{MaxDepth: -1}, ts, "/0")
+	if got, want := s.requested(), []string{"/0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with MaxDepth -1, requested %v, want %v", got, want)
+	}
+}
+
+func TestSameDomain(t *testing.T) {
+	other := &site{pages: map[string]string{"/": `<a href="/more">`}}
+	ots := start(t, other)
+	s := &site{pages: map[string]string{
+		"/":  `<a href="/redirect">`,
+		"/a": `<a href="` + ots.URL + `/">`,
+	}}
+	mux := http.NewServeMux()
+	mux.Handle("/", s)
+	mux.Handle("/redirect", http.RedirectHandler("/a", http.StatusFound))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	crawlAll(t, crawl.Options{SameDomain: true}, ts, "/")
+	if got, want := s.requested(), []string{"/", "/a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requested %v, want %v", got, want)
+	}
+	if got := other.requested(); got != nil {
+		t.Errorf("requested %v from another host", got)
+	}
+
+	crawlAll(t, crawl.Options{}, ts, "/")
+	if got, want := other.requested(), []string{"/", "/more"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("without SameDomain, requested %v from another host, want %v", got, want)
+	}
+}
+
+func TestRobots(t *testing.T) {
+	s := &site{
+		pages: map[string]string{
+			"/":             `<a href="/private/x">`,
+			"/public":       `<a href="/private/y"> <a href="/page.php">`,
+			"/private/x":    `secret`,
+			"/private/open": `<a href="/public">`,
+		},
+		robots: "User-agent: *\n" +
+			"Disallow: /\n" +
+			"\n" +
+			"User-agent: testbot\n" +
+			"Disallow: /private\n" +
+			"Allow: /private/open\n" +
+			"Disallow: /*.php$\n",
+	}
+	ts := start(t, s)
+	pages := crawlAll(t, crawl.Options{UserAgent: "TestBot/1.0"}, ts, "/")
+	crawlAll(t, crawl.Options{UserAgent: "TestBot/1.0"}, ts, "/private/open")
+
+	if got, want := s.requested(), []string{"/", "/private/open", "/public"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requested %v, want %v", got, want)
+	}
+	if p := pages["/private/x"]; p == nil || p.Err != crawl.ErrDisallowed {
+		t.Errorf("/private/x: got %+v, want error %v", p, crawl.ErrDisallowed)
+	}
+	if n := s.count("/robots.txt"); n != 2 {
+		t.Errorf("robots.txt requested %d times in two crawls, want 2", n)
+	}
+
+	// Other agents are disallowed everything.
+	s.reset()
+	pages = crawlAll(t, crawl.Options{}, ts, "/")
+	if got := s.requested(); got != nil {
+		t.Errorf("requested %v, want nothing", got)
+	}
+	if p := pages["/"]; p == nil || p.Err != crawl.ErrDisallowed {
+		t.Errorf("/: got %+v, want error %v", p, crawl.ErrDisallowed)
+	}
+}
+
+// fanOut returns the pages of a site whose index links to n pages.
+func fanOut(n int) map[string]string {
+	pages := map[string]string{"/": ""}
+	for i := 0; i < n; i++ {
+		path := fmt.Sprintf("/%d", i)
+		pages["/"] += `<a href="` + path + `">`
+		pages[path] = ""
+	}
+	return pages
+}
+
+func TestPerHost(t *testing.T) {
+	s := &site{pages: fanOut(10), serve: 10 * time.Millisecond}
+	ts := start(t, s)
+	crawlAll(t, crawl.Options{Workers: 10, PerHost: 2}, ts, "/")
+	if len(s.requested()) != 11 {
+		t.Errorf("requested %d pages, want 11", len(s.requested()))
+	}
+	if _, max := s.log(); max != 2 {
+		t.Errorf("at most %d concurrent requests, want 2", max)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	s := &site{pages: fanOut(4)}
+	ts := start(t, s)
+	crawlAll(t, crawl.Options{Workers: 10, PerHost: 4, Delay: delay}, ts, "/")
+
+	// The requests include robots.txt.
+	times, _ := s.log()
+	if len(times) != 6 {
+		t.Fatalf("%d requests, want 6", len(times))
+	}
+	span := times[5].Sub(times[0])
+	if min := 5*delay - delay/2; span < min {
+		t.Errorf("6 requests took %v, want at least %v", span, min)
+	}
+
+	// A longer Crawl-delay in robots.txt prevails, though not for
+	// robots.txt itself.
+	s = &site{pages: fanOut(2), robots: "User-agent: *\nCrawl-delay: 0.05\n"}
+	ts = start(t, s)
+	crawlAll(t, crawl.Options{Workers: 10, PerHost: 4, Delay: delay}, ts, "/")
+	times, _ = s.log()
+	if len(times) != 4 {
+		t.Fatalf("%d requests, want 4", len(times))
+	}
+	span = times[3].Sub(times[1])
+	if min := 100*time.Millisecond - delay/2; span < min {
+		t.Errorf("3 pages took %v, want at least %v", span, min)
+	}
+}
+
+// TestSlowHost checks that links to a slow host, waiting for its
+// delay, do not hold up those to other hosts.
+func TestSlowHost(t *testing.T) {
+	slow := &site{pages: fanOut(5), robots: "User-agent: *\nCrawl-delay: 1\n"}
+	sts := start(t, slow)
+	fast := &site{pages: fanOut(5)}
+	fts := start(t, fast)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	begin := time.Now()
+	var elapsed time.Duration
+	visited := 0
+	seeds := []string{sts.URL + "/", fts.URL + "/"}
+	crawl.Options{Workers: 2}.Crawl(ctx, seeds, func(p *crawl.Page) {
+		if strings.HasPrefix(p.URL, fts.URL) {
+			if visited++; visited == 6 {
+				elapsed = time.Since(begin)
+				cancel()
+			}
+		}
+	})
+	if visited != 6 {
+		t.Fatalf("visited %d pages of the fast host, want 6", visited)
+	}
+	if max := 500 * time.Millisecond; elapsed > max {
+		t.Errorf("fast host took %v, want at most %v", elapsed, max)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	// An infinite site: each page links to the next.
+	var mu sync.Mutex
+	served := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		served++
+		mu.Unlock()
+		var n int
+		fmt.Sscanf(req.URL.Path, "/%d", &n)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<a href="/%d">next</a>`, n+1)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	visited := 0
+	err := crawl.Crawl(ctx, []string{ts.URL + "/0"}, func(p *crawl.Page) {
+		if visited++; visited == 10 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("Crawl returned %v, want %v", err, context.Canceled)
+	}
+	if visited != 10 {
+		t.Errorf("visited %d pages after cancellation at 10", visited)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if served < 10 {
+		t.Errorf("served %d pages, want at least 10", served)
+	}
+}
+
+func TestBadSeed(t *testing.T) {
+	var bad []string
+	err := crawl.Crawl(context.Background(), []string{"ftp://example.com/", ":"}, func(p *crawl.Page) {
+		if p.Err != nil {
+			bad = append(bad, p.URL)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ftp://example.com/", ":"}; !reflect.DeepEqual(bad, want) {
+		t.Errorf("bad seeds %v, want %v", bad, want)
+	}
+}
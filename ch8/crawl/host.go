@@ -0,0 +1,141 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package crawl
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// maxRobots is the number of bytes of a robots.txt file that are read.
+const maxRobots = 500 << 10
+
+// A host holds the rules and limits of the requests to a host.
+type host struct {
+	sema chan struct{} // a counting semaphore limiting concurrent requests
+
+	ready  chan struct{} // closed when robots and delay are set
+	robots *robots
+	delay  time.Duration // minimum time between the starts of requests
+
+	mu   sync.Mutex
+	next time.Time // earliest start of the next request
+}
+
+// host returns the host of u, first fetching its robots.txt file
+// if this is the first request to it.
+func (c *crawler) host(ctx context.Context, u *url.URL) (*host, error) {
+	site := u.Scheme + "://" + u.Host
+	c.mu.Lock()
+	h, ok := c.hosts[site]
+	if !ok {
+		h = &host{
+			sema:  make(chan struct{}, c.PerHost),
+			ready: make(chan struct{}),
+		}
+		c.hosts[site] = h
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		h.robots = c.fetchRobots(ctx, h, site)
+		h.delay = c.Delay
+		if h.robots.delay > h.delay {
+			h.delay = h.robots.delay
+		}
+		close(h.ready)
+	}
+	select {
+	case <-h.ready:
+		return h, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetchRobots fetches and parses the robots.txt file of site.
+// As RFC 9309 prescribes, a missing file allows everything, and
+// a server that cannot be reached or fails allows nothing.
+func (c *crawler) fetchRobots(ctx context.Context, h *host, site string) *robots {
+	release, err := c.acquire(ctx, h, c.Delay)
+	if err != nil {
+		return disallowAll
+	}
+	defer release()
+	req, err := http.NewRequestWithContext(ctx, "GET", site+"/robots.txt", nil)
+	if err != nil {
+		return disallowAll
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return disallowAll
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500:
+		return disallowAll
+	case resp.StatusCode != http.StatusOK:
+		return allowAll
+	}
+	return parseRobots(io.LimitReader(resp.Body, maxRobots), c.UserAgent)
+}
+
+// acquire waits until a request may be sent to h, as h.acquire
+// does, and then until fewer than c.Workers requests are in
+// progress.  It returns a function to call when the request is
+// complete.
+func (c *crawler) acquire(ctx context.Context, h *host, delay time.Duration) (release func(), err error) {
+	releaseHost, err := h.acquire(ctx, delay)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case c.tokens <- struct{}{}: // acquire token
+	case <-ctx.Done():
+		releaseHost()
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-c.tokens // release token
+		releaseHost()
+	}, nil
+}
+
+// acquire waits until a request may be sent to h: until fewer than
+// the maximum requests to h are in progress, and at least delay has
+// passed since the start of the previous one.  It returns a function
+// to call when the request is complete.
+func (h *host) acquire(ctx context.Context, delay time.Duration) (release func(), err error) {
+	select {
+	case h.sema <- struct{}{}: // acquire token
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release = func() { <-h.sema } // release token
+
+	h.mu.Lock()
+	start := time.Now()
+	if h.next.After(start) {
+		start = h.next
+	}
+	h.next = start.Add(delay)
+	h.mu.Unlock()
+
+	if d := time.Until(start); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
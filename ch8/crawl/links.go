@@ -0,0 +1,100 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package crawl
+
+import (
+	"html"
+	"io"
+	"strings"
+)
+
+// maxPage is the number of bytes of a page that are scanned for links.
+const maxPage = 4 << 20
+
+const space = " \t\r\n\f"
+
+// extractLinks returns the href attributes of the <a> and <area>
+// elements in an HTML document.  It is a scanner, not a parser like
+// that of gopl.io/ch5/links: it skips comments, but not the contents
+// of <script> elements.
+func extractLinks(doc io.Reader) ([]string, error) {
+	data, err := io.ReadAll(io.LimitReader(doc, maxPage))
+	if err != nil {
+		return nil, err
+	}
+	var links []string
+	for s := string(data); ; {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			return links, nil
+		}
+		s = s[i+1:]
+		if strings.HasPrefix(s, "!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				return links, nil
+			}
+			s = s[end+len("-->"):]
+			continue
+		}
+		if s == "" || !isAlpha(s[0]) {
+			continue // text, an end tag, or a declaration
+		}
+		var name string
+		var attrs map[string]string
+		name, attrs, s = scanTag(s)
+		if href, ok := attrs["href"]; ok && (name == "a" || name == "area") {
+			if href = strings.TrimSpace(href); href != "" {
+				links = append(links, href)
+			}
+		}
+	}
+}
+
+// scanTag scans a tag from the start of s, which follows its "<".
+// It returns the name of the tag and its attributes, with the names
+// in lower case and the values unescaped, and the rest of s.
+func scanTag(s string) (name string, attrs map[string]string, rest string) {
+	i := 0
+	for i < len(s) && (isAlpha(s[i]) || i > 0 && '0' <= s[i] && s[i] <= '9') {
+		i++
+	}
+	name, s = strings.ToLower(s[:i]), s[i:]
+	attrs = make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, space+"/")
+		if s == "" || s[0] == '>' {
+			return name, attrs, strings.TrimPrefix(s, ">")
+		}
+		i := strings.IndexAny(s[1:], space+"/=>") + 1 // the first byte may be '='
+		if i == 0 {
+			i = len(s)
+		}
+		key := strings.ToLower(s[:i])
+		s = strings.TrimLeft(s[i:], space)
+
+		var value string
+		if strings.HasPrefix(s, "=") {
+			s = strings.TrimLeft(s[1:], space)
+			if s != "" && (s[0] == '"' || s[0] == '\'') {
+				end := strings.IndexByte(s[1:], s[0]) + 1
+				if end == 0 {
+					end = len(s)
+				}
+				value, s = s[1:end], s[min(end+1, len(s)):]
+			} else {
+				end := strings.IndexAny(s, space+">")
+				if end < 0 {
+					end = len(s)
+				}
+				value, s = s[:end], s[end:]
+			}
+		}
+		if _, ok := attrs[key]; !ok { // the first of duplicate attributes wins
+			attrs[key] = html.UnescapeString(value)
+		}
+	}
+}
+
+func isAlpha(b byte) bool { return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' }
@@ -0,0 +1,33 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package crawl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	const doc = `<!DOCTYPE html>
+<html><head><link href="/style.css" rel=stylesheet></head>
+<body>
+<p>1 < 2 and 3 > 2</p>
+<a href="/one">one</a>
+<A class="x" HREF='two?a=1&amp;b=2'>two</A>
+<a href=three>three</a><a href = " /four ">four</a>
+<!-- <a href="/commented"> -->
+<a name="anchor">no href</a>
+<area shape=rect href="/five">
+<a title="a > b" href="/six" href="/ignored">six</a>
+<a href="/seven"`
+	got, err := extractLinks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/one", "two?a=1&b=2", "three", "/four", "/five", "/six", "/seven"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extractLinks() = %q, want %q", got, want)
+	}
+}
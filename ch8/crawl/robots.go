@@ -0,0 +1,138 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package crawl
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A robots holds the rules of a robots.txt file for one user agent.
+type robots struct {
+	rules []rule
+	delay time.Duration // the Crawl-delay, or zero
+}
+
+// A rule allows or disallows the paths that match its pattern.
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+var (
+	allowAll    = &robots{}
+	disallowAll = &robots{rules: []rule{{false, "/"}}}
+)
+
+// parseRobots parses a robots.txt file, as specified by RFC 9309,
+// and returns the rules of the groups for agent, or if there are
+// none, the groups for "*".  It ignores lines it does not understand.
+//
+// A group is one or more User-agent lines followed by rules.  A group
+// is for agent if a User-agent line names the product token of agent,
+// the part before any "/", ignoring case.
+func parseRobots(r io.Reader, agent string) *robots {
+	token := agent
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	var mine, all robots
+	found := false                // whether a group is for agent
+	forMe, forAny := false, false // whether the current group is for agent or "*"
+	inRules := false              // whether the current group has rules, so a User-agent line starts another
+	input := bufio.NewScanner(r)
+	for input.Scan() {
+		line := input.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if inRules {
+				forMe, forAny, inRules = false, false, false
+			}
+			if value == "*" {
+				forAny = true
+			} else if strings.EqualFold(value, token) {
+				forMe, found = true, true
+			}
+			continue
+		}
+		inRules = true
+		for _, g := range []struct {
+			in bool
+			r  *robots
+		}{{forMe, &mine}, {forAny, &all}} {
+			if !g.in {
+				continue
+			}
+			switch key {
+			case "allow", "disallow":
+				if value != "" { // an empty Disallow disallows nothing
+					g.r.rules = append(g.r.rules, rule{key == "allow", value})
+				}
+			case "crawl-delay":
+				if secs, err := strconv.ParseFloat(value, 64); err == nil && secs >= 0 {
+					g.r.delay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+	if found {
+		return &mine
+	}
+	return &all
+}
+
+// allowed reports whether the rules allow the path, with any query.
+// The rule with the longest matching pattern applies, and an allow
+// rule wins a tie.  With no matching rule, the path is allowed.
+func (r *robots) allowed(path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+	allow, longest := true, -1
+	for _, rule := range r.rules {
+		n := len(rule.pattern)
+		if (n > longest || n == longest && rule.allow) && match(rule.pattern, path) {
+			allow, longest = rule.allow, n
+		}
+	}
+	return allow
+}
+
+// match reports whether path matches pattern, a prefix of the path
+// in which "*" stands for any sequence of characters and a final
+// "$" for the end of the path.
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path = path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path, part) // the last part ends the path
+		}
+		j := strings.Index(path, part)
+		if j < 0 {
+			return false
+		}
+		path = path[j+len(part):]
+	}
+	return !anchored || path == ""
+}
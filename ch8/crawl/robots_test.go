@@ -0,0 +1,89 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package crawl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish", false},
+		{"/fish/", "/fish", false},
+		{"/*.php", "/index.php?x=1", true},
+		{"/*.php", "/a/b.php", true},
+		{"/*.php$", "/a.php", true},
+		{"/*.php$", "/a.php?x", false},
+		{"/*.php$", "/a.php.php", true},
+		{"/a$", "/a", true},
+		{"/a$", "/ab", false},
+		{"/a*b*c", "/abxc", true},
+		{"/a*b*c", "/acb", false},
+		{"/a*$", "/anything", true},
+	} {
+		if got := match(test.pattern, test.path); got != test.want {
+			t.Errorf("match(%q, %q) = %t", test.pattern, test.path, got)
+		}
+	}
+}
+
+const robotsTxt = `# A comment.
+User-agent: *
+Disallow: /private/   # trailing comment
+Crawl-delay: 2
+
+User-agent: OtherBot
+User-agent: testbot
+Disallow: /
+Allow: /public
+Allow: /page
+Disallow: /page
+Crawl-delay: 0.5
+
+User-agent: nobody
+Disallow: /public
+`
+
+func TestParseRobots(t *testing.T) {
+	r := parseRobots(strings.NewReader(robotsTxt), "TestBot/2.1 (+http://example.com)")
+	want := &robots{
+		rules: []rule{{false, "/"}, {true, "/public"}, {true, "/page"}, {false, "/page"}},
+		delay: 500 * time.Millisecond,
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("parseRobots(TestBot) = %+v, want %+v", r, want)
+	}
+	for path, want := range map[string]bool{
+		"/":            false,
+		"/private/x":   false,
+		"/public/x":    true,
+		"/page":        true, // allow wins a tie
+		"/robots.txt":  true,
+		"/publication": true,
+	} {
+		if got := r.allowed(path); got != want {
+			t.Errorf("TestBot: allowed(%q) = %t", path, got)
+		}
+	}
+
+	r = parseRobots(strings.NewReader(robotsTxt), "gopl-crawl")
+	want = &robots{rules: []rule{{false, "/private/"}}, delay: 2 * time.Second}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("parseRobots(gopl-crawl) = %+v, want %+v", r, want)
+	}
+
+	// A group with no rules allows everything.
+	r = parseRobots(strings.NewReader("User-agent: *\nDisallow: /\nUser-agent: a\nDisallow:\n"), "a")
+	if !r.allowed("/x") {
+		t.Errorf("empty Disallow: /x disallowed")
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Crawl4 crawls web links starting with the command-line arguments.
+//
+// Unlike crawl3, it stops when no links remain, or at an interrupt.
+// It follows links to the -depth limit, by default only within the
+// hosts of the arguments, and it obeys robots.txt and limits the
+// requests to each host.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"gopl.io/ch8/crawl"
+)
+
+var (
+	depth   = flag.Int("depth", 3, "maximum number of links to follow (0 means no limit, -1 none)")
+	same    = flag.Bool("same", true, "follow links only within the hosts of the arguments")
+	workers = flag.Int("workers", 20, "maximum number of concurrent requests")
+	perHost = flag.Int("perhost", 2, "maximum number of concurrent requests to each host")
+	delay   = flag.Duration("delay", 500*time.Millisecond, "minimum time between requests to each host")
+)
+
+func main() {
+	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := crawl.Options{
+		MaxDepth:   *depth,
+		SameDomain: *same,
+		Workers:    *workers,
+		PerHost:    *perHost,
+		Delay:      *delay,
+	}
+	err := opts.Crawl(ctx, flag.Args(), func(p *crawl.Page) {
+		switch {
+		case p.Err == crawl.ErrDisallowed:
+			log.Printf("%s: %v", p.URL, p.Err)
+		case p.Err != nil:
+			log.Print(p.Err)
+		default:
+			fmt.Println(p.URL)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
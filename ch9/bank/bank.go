@@ -0,0 +1,199 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Package bank provides concurrency-safe banks with many accounts.
+//
+// There are three implementations of the Bank interface, using the
+// strategies of gopl.io/ch9/bank1, bank2 and bank3:
+// NewMonitor confines the accounts to a monitor goroutine,
+// NewSemaphore guards them with a binary semaphore, and
+// NewMutex guards each account with its own Mutex.
+//
+// A Bank made by Options may record its transactions in a Log, such
+// as gopl.io/ch9/bank/wal, from which its State may be recovered.
+package bank
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A Bank holds named accounts.  An account comes into existence,
+// with a zero balance, when it is first used.
+type Bank interface {
+	// Deposit adds amount to the balance of account.
+	Deposit(account string, amount int) error
+
+	// Withdraw subtracts amount from the balance of account.
+	// It fails, changing nothing, if the balance is insufficient.
+	Withdraw(account string, amount int) error
+
+	// Transfer atomically withdraws amount from one account
+	// and deposits it in another.
+	Transfer(from, to string, amount int) error
+
+	// Balance returns the balance of account.
+	Balance(account string) int
+
+	// Journal returns the successful transactions, in order,
+	// since the initial state of the Bank.
+	Journal() []Transaction
+
+	// Close releases the resources of the Bank.
+	// Clients must not use the Bank after Close.
+	Close()
+}
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrInvalidAmount     = errors.New("amount must be positive")
+	ErrSameAccount       = errors.New("transfer to the same account")
+	ErrEmptyName         = errors.New("account name is empty")
+)
+
+// A Transaction is an entry in the journal of a Bank.
+// A deposit has only To, a withdrawal only From,
+// and a transfer both.
+type Transaction struct {
+	Seq      int // sequence number, from 1 after the initial state
+	From, To string
+	Amount   int
+}
+
+func (t Transaction) String() string {
+	return fmt.Sprintf("#%d: %s", t.Seq, t.describe())
+}
+
+func (t Transaction) describe() string {
+	switch {
+	case t.From == "":
+		return fmt.Sprintf("deposit %d to %s", t.Amount, t.To)
+	case t.To == "":
+		return fmt.Sprintf("withdraw %d from %s", t.Amount, t.From)
+	}
+	return fmt.Sprintf("transfer %d from %s to %s", t.Amount, t.From, t.To)
+}
+
+// check reports whether t is well formed, and whether it can be
+// applied when the balance of t.From is fromBalance.
+func (t Transaction) check(fromBalance int) error {
+	var err error
+	switch {
+	case t.Amount <= 0:
+		err = ErrInvalidAmount
+	case t.From != "" && t.From == t.To:
+		err = ErrSameAccount
+	case t.From != "" && fromBalance < t.Amount:
+		err = ErrInsufficientFunds
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s: %w", t.describe(), err)
+}
+
+// checkNames reports whether each account used by operation op, of
+// amount, is named.  It is checked before the Transaction is made,
+// as one without From or To describes a different operation.
+func checkNames(op string, amount int, accounts ...string) error {
+	for _, name := range accounts {
+		if name == "" {
+			return fmt.Errorf("%s %d: %w", op, amount, ErrEmptyName)
+		}
+	}
+	return nil
+}
+
+// A Log durably records the transactions of a Bank.
+type Log interface {
+	// Append records t, which the Bank will apply if and only if
+	// Append succeeds.  Calls are made in the order of Seq.
+	Append(t Transaction) error
+}
+
+// A State is the balances of the accounts of a Bank after
+// the transaction numbered Seq.
+type State struct {
+	Seq      int
+	Balances map[string]int
+}
+
+// Apply updates s to reflect t, which must be the next transaction
+// and valid in state s.
+func (s *State) Apply(t Transaction) {
+	if s.Balances == nil {
+		s.Balances = make(map[string]int)
+	}
+	if t.From != "" {
+		s.Balances[t.From] -= t.Amount
+	}
+	if t.To != "" {
+		s.Balances[t.To] += t.Amount
+	}
+	s.Seq = t.Seq
+}
+
+// Options configure a Bank.
+// The zero value is an empty Bank without a Log.
+type Options struct {
+	State State // the initial state
+	Log   Log   // if non-nil, records each transaction before it is applied
+}
+
+// NewMonitor returns a Bank whose accounts are confined to a
+// monitor goroutine.  Clients must subsequently call Close.
+func NewMonitor() Bank { return Options{}.NewMonitor() }
+
+// NewSemaphore returns a Bank whose accounts are guarded by a
+// binary semaphore.
+func NewSemaphore() Bank { return Options{}.NewSemaphore() }
+
+// NewMutex returns a Bank each of whose accounts is guarded by a Mutex.
+//
+// A transfer locks both of its accounts, always in order of
+// their names, so that two opposing transfers cannot deadlock.
+func NewMutex() Bank { return Options{}.NewMutex() }
+
+// A ledger is the state of a Bank that is guarded as a whole,
+// by the monitor and semaphore implementations.
+type ledger struct {
+	State
+	journal []Transaction
+	log     Log
+}
+
+func newLedger(o Options) *ledger {
+	l := &ledger{State: State{Seq: o.State.Seq, Balances: make(map[string]int)}, log: o.Log}
+	for name, balance := range o.State.Balances {
+		l.Balances[name] = balance
+	}
+	return l
+}
+
+// apply performs t, if possible, and records it in the log and journal.
+func (l *ledger) apply(t Transaction) error {
+	if err := t.check(l.Balances[t.From]); err != nil {
+		return err
+	}
+	t.Seq = l.Seq + 1
+	if err := logAppend(l.log, t); err != nil {
+		return err
+	}
+	l.Apply(t)
+	l.journal = append(l.journal, t)
+	return nil
+}
+
+// logAppend appends t to log, if any.
+func logAppend(log Log, t Transaction) error {
+	if log == nil {
+		return nil
+	}
+	if err := log.Append(t); err != nil {
+		return fmt.Errorf("%s: %w", t.describe(), err)
+	}
+	return nil
+}
+
+func (l *ledger) copyJournal() []Transaction {
+	return append([]Transaction(nil), l.journal...)
+}
@@ -0,0 +1,230 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bank_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"gopl.io/ch9/bank"
+)
+
+var implementations = []struct {
+	name string
+	new  func() bank.Bank
+}{
+	{"Monitor", bank.NewMonitor},
+	{"Semaphore", bank.NewSemaphore},
+	{"Mutex", bank.NewMutex},
+}
+
+// forEach calls test for each implementation of Bank.
+func forEach(t *testing.T, test func(t *testing.T, b bank.Bank)) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			b := impl.new()
+			defer b.Close()
+			test(t, b)
+		})
+	}
+}
+
+var accounts = []string{"alice", "bob", "carol", "dave"}
+
+func TestDeposit(t *testing.T) {
+	forEach(t, func(t *testing.T, b bank.Bank) {
+		// Deposit [1..1000] concurrently, in turn to each account.
+		var n sync.WaitGroup
+		for i := 1; i <= 1000; i++ {
+			n.Add(1)
+			go func(amount int) {
+				defer n.Done()
+				if err := b.Deposit(accounts[amount%len(accounts)], amount); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		n.Wait()
+
+		for i, name := range accounts {
+			want := 0
+			for amount := 1; amount <= 1000; amount++ {
+				if amount%len(accounts) == i {
+					want += amount
+				}
+			}
+			if got := b.Balance(name); got != want {
+				t.Errorf("Balance(%s) = %d, want %d", name, got, want)
+			}
+		}
+	})
+}
+
+func TestErrors(t *testing.T) {
+	forEach(t, func(t *testing.T, b bank.Bank) {
+		b.Deposit("alice", 100)
+		for _, test := range []struct {
+			err  error
+			want error
+			msg  string
+		}{
+			{b.Withdraw("alice", 101), bank.ErrInsufficientFunds,
+				"withdraw 101 from alice: insufficient funds"},
+			{b.Withdraw("bob", 1), bank.ErrInsufficientFunds,
+				"withdraw 1 from bob: insufficient funds"},
+			{b.Transfer("alice", "bob", 200), bank.ErrInsufficientFunds,
+				"transfer 200 from alice to bob: insufficient funds"},
+			{b.Transfer("alice", "alice", 1), bank.ErrSameAccount,
+				"transfer 1 from alice to alice: transfer to the same account"},
+			{b.Deposit("alice", 0), bank.ErrInvalidAmount,
+				"deposit 0 to alice: amount must be positive"},
+			{b.Withdraw("alice", -5), bank.ErrInvalidAmount,
+				"withdraw -5 from alice: amount must be positive"},
+			{b.Transfer("", "bob", 1000), bank.ErrEmptyName,
+				"transfer 1000: account name is empty"},
+			{b.Transfer("alice", "", 1), bank.ErrEmptyName,
+				"transfer 1: account name is empty"},
+			{b.Deposit("", 5), bank.ErrEmptyName,
+				"deposit 5: account name is empty"},
+			{b.Withdraw("", 5), bank.ErrEmptyName,
+				"withdraw 5: account name is empty"},
+		} {
+			if !errors.Is(test.err, test.want) || test.err.Error() != test.msg {
+				t.Errorf("got error %v, want %q", test.err, test.msg)
+			}
+		}
+		if got := b.Balance("alice"); got != 100 {
+			t.Errorf("after failed transactions, Balance(alice) = %d, want 100", got)
+		}
+		if got := b.Balance("bob"); got != 0 {
+			t.Errorf("after failed transactions, Balance(bob) = %d, want 0", got)
+		}
+		if got := b.Balance(""); got != 0 {
+			t.Errorf("after failed transactions, Balance(\"\") = %d, want 0", got)
+		}
+		if got := len(b.Journal()); got != 1 {
+			t.Errorf("journal has %d transactions, want 1", got)
+		}
+
+		if err := b.Withdraw("alice", 100); err != nil {
+			t.Errorf("Withdraw of whole balance: %v", err)
+		}
+	})
+}
+
+// TestTransfer makes many concurrent transfers in both directions
+// between each pair of accounts.  It fails by deadlock if Transfer
+// does not lock consistently.
+func TestTransfer(t *testing.T) {
+	forEach(t, func(t *testing.T, b bank.Bank) {
+		for _, name := range accounts {
+			b.Deposit(name, 1000)
+		}
+		var n sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			n.Add(1)
+			go func(seed int64) {
+				defer n.Done()
+				rng := rand.New(rand.NewSource(seed))
+				for i := 0; i < 500; i++ {
+					from := accounts[rng.Intn(len(accounts))]
+					to := accounts[rng.Intn(len(accounts))]
+					err := b.Transfer(from, to, 1+rng.Intn(300))
+					if err != nil && (from != to) != errors.Is(err, bank.ErrInsufficientFunds) {
+						t.Error(err)
+					}
+					if i%50 == 0 {
+						b.Withdraw(from, 1)
+						b.Deposit(to, 1)
+					}
+				}
+			}(int64(g))
+		}
+		n.Wait()
+
+		total := 0
+		for _, name := range accounts {
+			balance := b.Balance(name)
+			if balance < 0 {
+				t.Errorf("Balance(%s) = %d", name, balance)
+			}
+			total += balance
+		}
+		// Transfers do not change the total.
+		want := 0
+		for _, tx := range b.Journal() {
+			if tx.From == "" {
+				want += tx.Amount
+			} else if tx.To == "" {
+				want -= tx.Amount
+			}
+		}
+		if total != want {
+			t.Errorf("total balance = %d, want %d", total, want)
+		}
+	})
+}
+
+// TestJournal checks that replaying the journal yields the balances.
+func TestJournal(t *testing.T) {
+	forEach(t, func(t *testing.T, b bank.Bank) {
+		var n sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			n.Add(1)
+			go func(seed int64) {
+				defer n.Done()
+				rng := rand.New(rand.NewSource(seed))
+				for i := 0; i < 200; i++ {
+					x := accounts[rng.Intn(len(accounts))]
+					y := accounts[rng.Intn(len(accounts))]
+					switch rng.Intn(3) {
+					case 0:
+						b.Deposit(x, rng.Intn(100))
+					case 1:
+						b.Withdraw(x, rng.Intn(100))
+					case 2:
+						b.Transfer(x, y, rng.Intn(100))
+					}
+				}
+			}(int64(g))
+		}
+		n.Wait()
+
+		balances := make(map[string]int)
+		for i, tx := range b.Journal() {
+			if tx.Seq != i+1 {
+				t.Fatalf("journal[%d].Seq = %d", i, tx.Seq)
+			}
+			balances[tx.From] -= tx.Amount
+			balances[tx.To] += tx.Amount
+			if tx.From != "" && balances[tx.From] < 0 {
+				t.Fatalf("%v overdraws %s", tx, tx.From)
+			}
+		}
+		for _, name := range accounts {
+			if got, want := b.Balance(name), balances[name]; got != want {
+				t.Errorf("Balance(%s) = %d, journal implies %d", name, got, want)
+			}
+		}
+	})
+}
+
+func ExampleTransaction() {
+	b := bank.NewMutex()
+	b.Deposit("alice", 100)
+	b.Transfer("alice", "bob", 30)
+	b.Withdraw("bob", 10)
+	for _, tx := range b.Journal() {
+		fmt.Println(tx)
+	}
+	fmt.Println(b.Balance("alice"), b.Balance("bob"))
+	// Output:
+	// #1: deposit 100 to alice
+	// #2: transfer 30 from alice to bob
+	// #3: withdraw 10 from bob
+	// 70 20
+}
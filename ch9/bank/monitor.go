@@ -0,0 +1,92 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bank
+
+// A request asks the teller to apply a transaction.
+type request struct {
+	t     Transaction
+	reply chan<- error
+}
+
+// A query asks the teller for the balance of an account.
+type query struct {
+	account string
+	reply   chan<- int
+}
+
+type monitor struct {
+	requests chan request
+	queries  chan query
+	journals chan chan []Transaction
+}
+
+// NewMonitor returns a Bank with options o whose accounts are
+// confined to a monitor goroutine.  Clients must subsequently call Close.
+func (o Options) NewMonitor() Bank {
+	b := &monitor{
+		requests: make(chan request),
+		queries:  make(chan query),
+		journals: make(chan chan []Transaction),
+	}
+	go b.teller(newLedger(o))
+	return b
+}
+
+func (b *monitor) teller(l *ledger) {
+	// l is confined to teller goroutine
+	for {
+		select {
+		case req, ok := <-b.requests:
+			if !ok {
+				return // closed
+			}
+			req.reply <- l.apply(req.t)
+		case q := <-b.queries:
+			q.reply <- l.Balances[q.account]
+		case reply := <-b.journals:
+			reply <- l.copyJournal()
+		}
+	}
+}
+
+func (b *monitor) apply(t Transaction) error {
+	reply := make(chan error)
+	b.requests <- request{t, reply}
+	return <-reply
+}
+
+func (b *monitor) Deposit(account string, amount int) error {
+	if err := checkNames("deposit", amount, account); err != nil {
+		return err
+	}
+	return b.apply(Transaction{To: account, Amount: amount})
+}
+
+func (b *monitor) Withdraw(account string, amount int) error {
+	if err := checkNames("withdraw", amount, account); err != nil {
+		return err
+	}
+	return b.apply(Transaction{From: account, Amount: amount})
+}
+
+func (b *monitor) Transfer(from, to string, amount int) error {
+	if err := checkNames("transfer", amount, from, to); err != nil {
+		return err
+	}
+	return b.apply(Transaction{From: from, To: to, Amount: amount})
+}
+
+func (b *monitor) Balance(account string) int {
+	reply := make(chan int)
+	b.queries <- query{account, reply}
+	return <-reply
+}
+
+func (b *monitor) Journal() []Transaction {
+	reply := make(chan []Transaction)
+	b.journals <- reply
+	return <-reply
+}
+
+func (b *monitor) Close() { close(b.requests) }
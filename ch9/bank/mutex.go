@@ -0,0 +1,134 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bank
+
+import "sync"
+
+// An account is guarded by its own Mutex, so that transactions
+// on different accounts proceed in parallel.
+type account struct {
+	mu      sync.Mutex // guards balance
+	balance int
+}
+
+type mutexBank struct {
+	mu       sync.Mutex // guards accounts
+	accounts map[string]*account
+
+	jmu     sync.Mutex // guards seq, journal and log
+	seq     int
+	journal []Transaction
+	log     Log
+}
+
+// NewMutex returns a Bank with options o each of whose accounts
+// is guarded by a Mutex.
+func (o Options) NewMutex() Bank {
+	b := &mutexBank{accounts: make(map[string]*account), seq: o.State.Seq, log: o.Log}
+	for name, balance := range o.State.Balances {
+		b.accounts[name] = &account{balance: balance}
+	}
+	return b
+}
+
+// account returns the named account, creating it if need be.
+func (b *mutexBank) account(name string) *account {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	a := b.accounts[name]
+	if a == nil {
+		a = new(account)
+		b.accounts[name] = a
+	}
+	return a
+}
+
+func (b *mutexBank) apply(t Transaction) error {
+	var from, to *account
+	if t.From != "" {
+		from = b.account(t.From)
+	}
+	if t.To != "" {
+		to = b.account(t.To)
+	}
+
+	// Lock the accounts in order of name.
+	first, second := from, to
+	if t.From > t.To {
+		first, second = to, from
+	}
+	if first != nil {
+		first.mu.Lock()
+		defer first.mu.Unlock()
+	}
+	if second != nil && second != first {
+		second.mu.Lock()
+		defer second.mu.Unlock()
+	}
+
+	var fromBalance int
+	if from != nil {
+		fromBalance = from.balance
+	}
+	if err := t.check(fromBalance); err != nil {
+		return err
+	}
+
+	// While the accounts are locked, the order of the journal
+	// and log agrees with the order of the transactions on
+	// each account.
+	b.jmu.Lock()
+	t.Seq = b.seq + 1
+	if err := logAppend(b.log, t); err != nil {
+		b.jmu.Unlock()
+		return err
+	}
+	b.seq = t.Seq
+	b.journal = append(b.journal, t)
+	b.jmu.Unlock()
+
+	if from != nil {
+		from.balance -= t.Amount
+	}
+	if to != nil {
+		to.balance += t.Amount
+	}
+	return nil
+}
+
+func (b *mutexBank) Deposit(account string, amount int) error {
+	if err := checkNames("deposit", amount, account); err != nil {
+		return err
+	}
+	return b.apply(Transaction{To: account, Amount: amount})
+}
+
+func (b *mutexBank) Withdraw(account string, amount int) error {
+	if err := checkNames("withdraw", amount, account); err != nil {
+		return err
+	}
+	return b.apply(Transaction{From: account, Amount: amount})
+}
+
+func (b *mutexBank) Transfer(from, to string, amount int) error {
+	if err := checkNames("transfer", amount, from, to); err != nil {
+		return err
+	}
+	return b.apply(Transaction{From: from, To: to, Amount: amount})
+}
+
+func (b *mutexBank) Balance(name string) int {
+	a := b.account(name)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.balance
+}
+
+func (b *mutexBank) Journal() []Transaction {
+	b.jmu.Lock()
+	defer b.jmu.Unlock()
+	return append([]Transaction(nil), b.journal...)
+}
+
+func (b *mutexBank) Close() {}
@@ -0,0 +1,59 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bank
+
+type semaphore struct {
+	sema chan struct{} // a binary semaphore guarding l
+	l    *ledger
+}
+
+// NewSemaphore returns a Bank with options o whose accounts are
+// guarded by a binary semaphore.
+func (o Options) NewSemaphore() Bank {
+	return &semaphore{sema: make(chan struct{}, 1), l: newLedger(o)}
+}
+
+func (b *semaphore) apply(t Transaction) error {
+	b.sema <- struct{}{} // acquire token
+	err := b.l.apply(t)
+	<-b.sema // release token
+	return err
+}
+
+func (b *semaphore) Deposit(account string, amount int) error {
+	if err := checkNames("deposit", amount, account); err != nil {
+		return err
+	}
+	return b.apply(Transaction{To: account, Amount: amount})
+}
+
+func (b *semaphore) Withdraw(account string, amount int) error {
+	if err := checkNames("withdraw", amount, account); err != nil {
+		return err
+	}
+	return b.apply(Transaction{From: account, Amount: amount})
+}
+
+func (b *semaphore) Transfer(from, to string, amount int) error {
+	if err := checkNames("transfer", amount, from, to); err != nil {
+		return err
+	}
+	return b.apply(Transaction{From: from, To: to, Amount: amount})
+}
+
+func (b *semaphore) Balance(account string) int {
+	b.sema <- struct{}{} // acquire token
+	balance := b.l.Balances[account]
+	<-b.sema // release token
+	return balance
+}
+
+func (b *semaphore) Journal() []Transaction {
+	b.sema <- struct{}{} // acquire token
+	journal := b.l.copyJournal()
+	<-b.sema // release token
+	return journal
+}
+
+func (b *semaphore) Close() {}
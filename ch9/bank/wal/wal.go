@@ -0,0 +1,385 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Package wal provides a write-ahead log for the transactions of a
+// bank.Bank, from which the state of the bank is recovered on startup.
+//
+// A WAL is a directory holding two files.  The file "log" holds a
+// record for each transaction since the last snapshot, and the file
+// "snapshot", if present, holds a record of the bank.State it follows.
+// Each record is a 12-byte header followed by a JSON payload.  The
+// header holds the length of the payload, its CRC-32C checksum, and
+// the checksum of those 8 bytes, all 4-byte big-endian numbers.
+// The header's own checksum guards the length, so damage to it
+// cannot make Open mistake the records that follow for a torn write.
+//
+// A record at the end of the log that is incomplete or whose payload
+// checksum is wrong is a torn write, left by a crash during Append.  So are
+// zeros at the end of the log, left by a crash after the file grew
+// but before the record's data reached it.  Open discards a torn
+// write; its transaction was never applied.  A bad record elsewhere
+// is an error.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopl.io/ch9/bank"
+)
+
+// ErrCorrupt is wrapped by the errors of Open for damage to a WAL
+// that a crash cannot explain.
+var ErrCorrupt = errors.New("corrupt write-ahead log")
+
+const headerLen = 12
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// A WAL is a write-ahead log.  It implements bank.Log.
+type WAL struct {
+	dir  string
+	opts Options
+
+	mu        sync.Mutex // guards the following
+	log       *os.File
+	out       io.Writer  // where records are written: log, or a fault injector
+	state     bank.State // the state after the last appended record
+	n         int        // number of records in log
+	discarded int64      // bytes of torn write discarded by Open
+	err       error      // if non-nil, the WAL has failed
+
+	// crash, if non-nil, is called at the named points during
+	// a snapshot, and may return an error to simulate a crash.
+	crash func(point string) error
+}
+
+// Options configure a WAL.
+type Options struct {
+	// SnapshotEvery is the number of records after which Append
+	// writes a snapshot and truncates the log.  Zero means never.
+	SnapshotEvery int
+}
+
+// Open opens the WAL in dir, creating it if need be, and returns
+// the bank state that it records.
+func Open(dir string) (*WAL, bank.State, error) { return Options{}.Open(dir) }
+
+// Open opens the WAL in dir with options o, creating it if need be,
+// and returns the bank state that it records.
+func (o Options) Open(dir string) (*WAL, bank.State, error) {
+	w := &WAL{dir: dir, opts: o}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, bank.State{}, err
+	}
+	if err := w.readSnapshot(); err != nil {
+		return nil, bank.State{}, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "log"), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, bank.State{}, err
+	}
+	w.log, w.out = f, f
+	if err := w.replay(); err != nil {
+		f.Close()
+		return nil, bank.State{}, err
+	}
+	return w, copyState(w.state), nil
+}
+
+// readSnapshot reads the snapshot, if any, into w.state.
+// A snapshot is written atomically, so it cannot be torn.
+func (w *WAL) readSnapshot() error {
+	name := filepath.Join(w.dir, "snapshot")
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	payload, err := readRecord(bufio.NewReader(f), info.Size())
+	if err == nil {
+		err = json.Unmarshal(payload, &w.state)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v (%w)", name, err, ErrCorrupt)
+	}
+	return nil
+}
+
+// replay applies the records of the log to w.state, discards a torn
+// write at the end, and leaves the log positioned for appending.
+func (w *WAL) replay() error {
+	info, err := w.log.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	in := bufio.NewReader(w.log)
+	var offset int64 // of the end of the last good record
+	for {
+		payload, err := readRecord(in, size-offset)
+		if err == io.EOF {
+			break
+		}
+		if err == errZero {
+			// A crash after the file grew but before the data
+			// landed leaves zeros; anything else is damage.
+			rest, err := io.ReadAll(in)
+			if err != nil {
+				return err
+			}
+			if !allZero(rest) {
+				return fmt.Errorf("%s: offset %d: %v (%w)", w.log.Name(), offset, errZero, ErrCorrupt)
+			}
+			w.discarded = size - offset
+			if err := w.log.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		end := offset + headerLen + int64(len(payload))
+		if err == errTorn || err == errChecksum && end == size {
+			// A torn write at the end of the log.
+			w.discarded = size - offset
+			if err := w.log.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		var t bank.Transaction
+		if err == nil {
+			err = json.Unmarshal(payload, &t)
+		}
+		if err == nil && t.Seq > w.state.Seq+1 {
+			err = fmt.Errorf("transaction #%d follows #%d", t.Seq, w.state.Seq)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: offset %d: %v (%w)", w.log.Name(), offset, err, ErrCorrupt)
+		}
+		if t.Seq > w.state.Seq { // else the log was not truncated after a snapshot
+			w.state.Apply(t)
+		}
+		w.n++
+		offset = end
+	}
+	_, err = w.log.Seek(offset, io.SeekStart)
+	return err
+}
+
+var (
+	errTorn     = errors.New("incomplete record")
+	errChecksum = errors.New("checksum mismatch")
+	errHeader   = errors.New("header checksum mismatch")
+	errZero     = errors.New("zero-filled record")
+)
+
+// allZero reports whether every byte of data is zero.
+func allZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// readRecord returns the payload of the next record from in, at
+// most remaining bytes from the end of its input.
+// It returns io.EOF if there are no more records.
+// If the payload's checksum is wrong, it returns the payload and
+// errChecksum.  If the header is all zeros, which no record has, as
+// payloads are never empty, it returns errZero; if it is otherwise
+// damaged, it returns errHeader.  It returns errTorn only for a
+// record with a sound header that extends beyond the input.
+func readRecord(in *bufio.Reader, remaining int64) ([]byte, error) {
+	var header [headerLen]byte
+	if _, err := io.ReadFull(in, header[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err == io.ErrUnexpectedEOF {
+		return nil, errTorn
+	} else if err != nil {
+		return nil, err
+	}
+	if header == [headerLen]byte{} {
+		return nil, errZero
+	}
+	if crc32.Checksum(header[:8], crcTable) != binary.BigEndian.Uint32(header[8:]) {
+		return nil, errHeader
+	}
+	n := int64(binary.BigEndian.Uint32(header[:4]))
+	if n > remaining-headerLen {
+		return nil, errTorn
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(in, payload); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, errTorn
+	} else if err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return payload, errChecksum
+	}
+	return payload, nil
+}
+
+// record returns the record of the JSON encoding of v.
+func record(v interface{}) ([]byte, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	rec := make([]byte, headerLen, headerLen+len(payload))
+	binary.BigEndian.PutUint32(rec[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.Checksum(payload, crcTable))
+	binary.BigEndian.PutUint32(rec[8:], crc32.Checksum(rec[:8], crcTable))
+	return append(rec, payload...), nil
+}
+
+// Append durably records t.  If it fails, the WAL fails all further
+// calls; the process should restart and recover its state by Open.
+// The transaction of the failed call may or may not be recovered.
+func (w *WAL) Append(t bank.Transaction) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	rec, err := record(t)
+	if err != nil {
+		return err
+	}
+	if _, err := w.out.Write(rec); err != nil {
+		w.err = fmt.Errorf("wal: %w", err)
+		return w.err
+	}
+	if err := w.log.Sync(); err != nil {
+		w.err = fmt.Errorf("wal: %w", err)
+		return w.err
+	}
+	w.state.Apply(t)
+	w.n++
+	if w.opts.SnapshotEvery > 0 && w.n >= w.opts.SnapshotEvery {
+		// t is durable even if the snapshot fails,
+		// but the WAL fails further calls.
+		if err := w.snapshot(); err != nil {
+			w.err = fmt.Errorf("wal: snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// Snapshot writes a snapshot of the recorded state and truncates the log.
+func (w *WAL) Snapshot() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.snapshot(); err != nil {
+		w.err = fmt.Errorf("wal: snapshot: %w", err)
+		return w.err
+	}
+	return nil
+}
+
+func (w *WAL) snapshot() error {
+	rec, err := record(w.state)
+	if err != nil {
+		return err
+	}
+
+	// Write the snapshot to a temporary file, then rename it,
+	// so that it replaces the old one atomically.
+	name := filepath.Join(w.dir, "snapshot")
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(rec); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := w.crashPoint("snapshot written"); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	if err := syncDir(w.dir); err != nil {
+		return err
+	}
+	if err := w.crashPoint("snapshot renamed"); err != nil {
+		return err
+	}
+
+	// A crash before the truncation is harmless: the records
+	// of the log precede the snapshot, and replay skips them.
+	if err := w.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.n = 0
+	return w.log.Sync()
+}
+
+func (w *WAL) crashPoint(point string) error {
+	if w.crash == nil {
+		return nil
+	}
+	return w.crash(point)
+}
+
+// syncDir commits the entries of directory dir to stable storage.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Discarded returns the number of bytes of torn write at the end of
+// the log that Open discarded.
+func (w *WAL) Discarded() int64 { return w.discarded }
+
+// Close closes the WAL.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = errors.New("wal: closed")
+	}
+	return w.log.Close()
+}
+
+func copyState(s bank.State) bank.State {
+	balances := make(map[string]int)
+	for name, balance := range s.Balances {
+		balances[name] = balance
+	}
+	return bank.State{Seq: s.Seq, Balances: balances}
+}
@@ -0,0 +1,279 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package wal
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopl.io/ch9/bank"
+)
+
+var errCrash = errors.New("injected crash")
+
+// A faultWriter writes limit bytes, then fails as if the process
+// had crashed in the middle of a write.
+type faultWriter struct {
+	w     io.Writer
+	limit int
+}
+
+func (fw *faultWriter) Write(p []byte) (int, error) {
+	if len(p) <= fw.limit {
+		fw.limit -= len(p)
+		return fw.w.Write(p)
+	}
+	n, _ := fw.w.Write(p[:fw.limit])
+	fw.limit = 0
+	return n, errCrash
+}
+
+// A zeroWriter writes limit zero bytes in place of the data, then
+// fails, as if the process had crashed after the file grew but
+// before the data was written.
+type zeroWriter struct {
+	w     io.Writer
+	limit int
+}
+
+func (zw *zeroWriter) Write(p []byte) (int, error) {
+	n, _ := zw.w.Write(make([]byte, zw.limit))
+	return n, errCrash
+}
+
+// open opens the WAL in dir and a Bank that records in it.
+func open(t *testing.T, dir string, o Options) (*WAL, bank.Bank) {
+	t.Helper()
+	w, state, err := o.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, bank.Options{State: state, Log: w}.NewMutex()
+}
+
+// recovered returns the state recovered from the WAL in dir.
+func recovered(t *testing.T, dir string) (bank.State, int64) {
+	t.Helper()
+	w, state, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	return state, w.Discarded()
+}
+
+func checkState(t *testing.T, dir string, want bank.State) {
+	t.Helper()
+	if got, _ := recovered(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("recovered %v, want %v", got, want)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+	w, b := open(t, dir, Options{})
+	b.Deposit("alice", 100)
+	b.Transfer("alice", "bob", 30)
+	b.Withdraw("bob", 40) // fails, and is not logged
+	b.Withdraw("bob", 10)
+	w.Close()
+
+	want := bank.State{Seq: 3, Balances: map[string]int{"alice": 70, "bob": 20}}
+	checkState(t, dir, want)
+
+	// The sequence continues after recovery.
+	w, b = open(t, dir, Options{})
+	b.Deposit("carol", 5)
+	if got := b.Journal(); len(got) != 1 || got[0].Seq != 4 {
+		t.Errorf("journal after recovery = %v, want #4 only", got)
+	}
+	w.Close()
+	want.Seq = 4
+	want.Balances["carol"] = 5
+	checkState(t, dir, want)
+}
+
+// TestTornWrite crashes in the middle of each byte of a record.
+func TestTornWrite(t *testing.T) {
+	rec, _ := record(bank.Transaction{Seq: 3, To: "alice", Amount: 1})
+	for limit := 0; limit < len(rec); limit++ {
+		dir := t.TempDir()
+		w, b := open(t, dir, Options{})
+		b.Deposit("alice", 100)
+		b.Withdraw("alice", 50)
+
+		w.out = &faultWriter{w.log, limit}
+		if err := b.Deposit("alice", 1); !errors.Is(err, errCrash) {
+			t.Fatalf("limit %d: Deposit returned %v, want crash", limit, err)
+		}
+		if got := b.Balance("alice"); got != 50 {
+			t.Errorf("limit %d: after failed Deposit, Balance = %d, want 50", limit, got)
+		}
+		if err := b.Deposit("alice", 2); !errors.Is(err, errCrash) {
+			t.Errorf("limit %d: Deposit after crash returned %v, want crash", limit, err)
+		}
+		w.log.Close()
+
+		state, discarded := recovered(t, dir)
+		want := bank.State{Seq: 2, Balances: map[string]int{"alice": 50}}
+		if !reflect.DeepEqual(state, want) || discarded != int64(limit) {
+			t.Errorf("limit %d: recovered %v, discarding %d bytes; want %v, discarding %d",
+				limit, state, discarded, want, limit)
+		}
+
+		// The log is usable after recovery.
+		w, b = open(t, dir, Options{})
+		b.Deposit("alice", 7)
+		w.Close()
+		want = bank.State{Seq: 3, Balances: map[string]int{"alice": 57}}
+		checkState(t, dir, want)
+	}
+}
+
+// TestZeroFilledTail crashes after the log grows by each of several
+// lengths but before the record's data is written.
+func TestZeroFilledTail(t *testing.T) {
+	rec, _ := record(bank.Transaction{Seq: 3, To: "alice", Amount: 1})
+	for _, limit := range []int{headerLen, headerLen + 1, len(rec), 3 * len(rec)} {
+		dir := t.TempDir()
+		w, b := open(t, dir, Options{})
+		b.Deposit("alice", 100)
+		b.Withdraw("alice", 50)
+
+		w.out = &zeroWriter{w.log, limit}
+		if err := b.Deposit("alice", 1); !errors.Is(err, errCrash) {
+			t.Fatalf("limit %d: Deposit returned %v, want crash", limit, err)
+		}
+		w.log.Close()
+
+		state, discarded := recovered(t, dir)
+		want := bank.State{Seq: 2, Balances: map[string]int{"alice": 50}}
+		if !reflect.DeepEqual(state, want) || discarded != int64(limit) {
+			t.Errorf("limit %d: recovered %v, discarding %d bytes; want %v, discarding %d",
+				limit, state, discarded, want, limit)
+		}
+
+		// The log is usable after recovery.
+		w, b = open(t, dir, Options{})
+		b.Deposit("alice", 7)
+		w.Close()
+		checkState(t, dir, bank.State{Seq: 3, Balances: map[string]int{"alice": 57}})
+	}
+
+	// Zeros followed by a record are damage, not a torn write.
+	dir := t.TempDir()
+	w, b := open(t, dir, Options{})
+	b.Deposit("alice", 100)
+	w.Close()
+	name := filepath.Join(dir, "log")
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(name, append(make([]byte, 2*headerLen), data...), 0666)
+	if _, _, err := Open(dir); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Open of log with zeros before a record returned %v, want ErrCorrupt", err)
+	}
+}
+
+// TestCorrupt damages records in the log.
+func TestCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	w, b := open(t, dir, Options{})
+	for i := 1; i <= 3; i++ {
+		b.Deposit("alice", i)
+	}
+	w.Close()
+	name := filepath.Join(dir, "log")
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recLen := len(data) / 3
+
+	// Damage to the last record is a torn write.
+	damaged := append([]byte(nil), data...)
+	damaged[len(damaged)-2] ^= 1
+	os.WriteFile(name, damaged, 0666)
+	state, discarded := recovered(t, dir)
+	if state.Balances["alice"] != 3 || discarded != int64(recLen) {
+		t.Errorf("recovered %v, discarding %d bytes; want alice=3, discarding %d",
+			state, discarded, recLen)
+	}
+
+	// Damage elsewhere is an error.
+	damaged = append([]byte(nil), data...)
+	damaged[recLen+headerLen+2] ^= 1
+	os.WriteFile(name, damaged, 0666)
+	if _, _, err := Open(dir); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Open of damaged log returned %v, want ErrCorrupt", err)
+	}
+
+	// So is damage to the length of a record other than the last,
+	// even if the length then extends beyond the end of the log.
+	for _, i := range []int{0, 3, recLen + 3} {
+		damaged = append([]byte(nil), data...)
+		damaged[i] ^= 0x80
+		os.WriteFile(name, damaged, 0666)
+		if _, _, err := Open(dir); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Open of log with damaged length at %d returned %v, want ErrCorrupt", i, err)
+		}
+	}
+
+	// So is a damaged snapshot.
+	os.WriteFile(name, nil, 0666)
+	os.WriteFile(filepath.Join(dir, "snapshot"), data[:recLen-1], 0666)
+	if _, _, err := Open(dir); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Open of damaged snapshot returned %v, want ErrCorrupt", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	w, b := open(t, dir, Options{SnapshotEvery: 3})
+	for i := 1; i <= 10; i++ {
+		b.Deposit("alice", i)
+	}
+	if w.n != 1 {
+		t.Errorf("after 10 transactions, log has %d records, want 1", w.n)
+	}
+	b.Withdraw("alice", 5)
+	if err := w.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if info, err := os.Stat(filepath.Join(dir, "log")); err != nil || info.Size() != 0 {
+		t.Errorf("after Snapshot, log is %v (%v), want empty", info.Size(), err)
+	}
+	checkState(t, dir, bank.State{Seq: 11, Balances: map[string]int{"alice": 50}})
+}
+
+// TestSnapshotCrash crashes at each point of a snapshot.
+func TestSnapshotCrash(t *testing.T) {
+	for _, point := range []string{"snapshot written", "snapshot renamed"} {
+		dir := t.TempDir()
+		w, b := open(t, dir, Options{SnapshotEvery: 2})
+		b.Deposit("alice", 1)
+		b.Deposit("alice", 2) // snapshot
+		b.Deposit("alice", 3)
+		w.crash = func(p string) error {
+			if p == point {
+				return errCrash
+			}
+			return nil
+		}
+		if err := b.Deposit("alice", 4); err != nil {
+			t.Errorf("%s: Deposit returned %v, want success", point, err)
+		}
+		if err := b.Deposit("alice", 5); !errors.Is(err, errCrash) {
+			t.Errorf("%s: Deposit after crash returned %v, want crash", point, err)
+		}
+		w.log.Close()
+		checkState(t, dir, bank.State{Seq: 4, Balances: map[string]int{"alice": 10}})
+	}
+}
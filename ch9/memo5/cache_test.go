@@ -0,0 +1,138 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package memo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A clock is a fake time source.
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// counter is a Func that counts its calls, and fails for keys
+// beginning with "!".
+type counter struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *counter) f(_ context.Context, key string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = make(map[string]int)
+	}
+	c.calls[key]++
+	if key[0] == '!' {
+		return nil, fmt.Errorf("bad key %s", key)
+	}
+	return key + "!", nil
+}
+
+func (c *counter) count(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[key]
+}
+
+// get is a sequence of requests and the expected number of calls
+// to the Func, per key, after each one.
+func get(t *testing.T, m *Memo, c *counter, keys string, wantCalls ...int) {
+	t.Helper()
+	for i, key := range keys {
+		m.Get(string(key))
+		if got := c.count(string(key)); got != wantCalls[i] {
+			t.Errorf("after Get(%c) #%d, %d calls, want %d", key, i, got, wantCalls[i])
+		}
+	}
+}
+
+func TestLRU(t *testing.T) {
+	var c counter
+	m := newMemo(c.f, Options{Capacity: 2}, time.Now)
+	defer m.Close()
+	get(t, m, &c, "ababcab",
+		1, 1, 1, 1, 1, // c evicts a, the least recently used
+		2, // a evicts b
+		2) // b evicts c
+	want := Stats{Hits: 2, Misses: 5, Evictions: 3, Entries: 2}
+	if got := m.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	var c counter
+	clk := &clock{t: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := newMemo(c.f, Options{TTL: time.Minute, ErrorTTL: time.Second}, clk.now)
+	defer m.Close()
+
+	get(t, m, &c, "a!", 1, 1)
+	clk.advance(time.Second) // ! expires
+	get(t, m, &c, "a!", 1, 2)
+	clk.advance(time.Minute - time.Second) // a and ! expire
+	get(t, m, &c, "a", 2)
+	want := Stats{Hits: 1, Misses: 4, Expirations: 3, Entries: 1}
+	if got := m.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestUncachedErrors(t *testing.T) {
+	var c counter
+	m := newMemo(c.f, Options{ErrorTTL: -1}, time.Now)
+	defer m.Close()
+	get(t, m, &c, "!a!a!", 1, 1, 2, 1, 3)
+	if _, err := m.Get("!"); err == nil || err.Error() != "bad key !" {
+		t.Errorf(`Get("!") returned error %v`, err)
+	}
+}
+
+func TestDedupStats(t *testing.T) {
+	// Block the Func until all the requests have arrived.
+	release := make(chan struct{})
+	f := func(key string) (interface{}, error) {
+		<-release
+		return key, nil
+	}
+	m := New(f)
+	defer m.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Get("x")
+		}()
+	}
+	for m.Stats().Misses+m.Stats().Dedups < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	m.Get("x")
+	want := Stats{Hits: 1, Misses: 1, Dedups: 4, Entries: 1}
+	if got := m.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
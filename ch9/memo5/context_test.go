@@ -0,0 +1,183 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package memo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopl.io/ch9/memo5"
+)
+
+// A blocker is a FuncContext that blocks until it is released
+// or its context is cancelled.  It sends the context of each call
+// on started.
+type blocker struct {
+	started chan context.Context
+	release chan struct{}
+}
+
+func newBlocker() *blocker {
+	return &blocker{make(chan context.Context, 10), make(chan struct{})}
+}
+
+func (b *blocker) f(ctx context.Context, key string) (interface{}, error) {
+	b.started <- ctx
+	select {
+	case <-b.release:
+		return key, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// getAsync calls m.GetContext in a new goroutine and returns
+// a channel that receives its error.
+func getAsync(m *memo.Memo, ctx context.Context, key string) <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		_, err := m.GetContext(ctx, key)
+		ch <- err
+	}()
+	return ch
+}
+
+// waitFor waits for the statistics of m to satisfy cond.
+func waitFor(t *testing.T, m *memo.Memo, cond func(memo.Stats) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(m.Stats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out; Stats() = %+v", m.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGetContextGiveUp(t *testing.T) {
+	b := newBlocker()
+	m := memo.NewContext(b.f)
+	defer m.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	impatient := getAsync(m, ctx, "x")
+	callCtx := <-b.started
+	patient := getAsync(m, context.Background(), "x")
+	waitFor(t, m, func(s memo.Stats) bool { return s.Dedups == 1 })
+
+	cancel()
+	if err := <-impatient; err != context.Canceled {
+		t.Errorf("impatient GetContext returned %v, want %v", err, context.Canceled)
+	}
+	waitFor(t, m, func(s memo.Stats) bool { return s.Abandoned == 1 })
+	if err := callCtx.Err(); err != nil {
+		t.Errorf("call was cancelled (%v) while a caller still waited", err)
+	}
+
+	close(b.release)
+	if err := <-patient; err != nil {
+		t.Errorf("patient GetContext returned %v", err)
+	}
+	if v, err := m.Get("x"); v != "x" || err != nil {
+		t.Errorf(`Get("x") = %v, %v; want x, nil`, v, err)
+	}
+	if s := m.Stats(); s.Misses != 1 || s.Cancels != 0 {
+		t.Errorf("Stats() = %+v, want 1 miss and no cancels", s)
+	}
+}
+
+func TestGetContextCancelAll(t *testing.T) {
+	b := newBlocker()
+	m := memo.NewContext(b.f)
+	defer m.Close()
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel2()
+	err1 := getAsync(m, ctx1, "x")
+	callCtx := <-b.started
+	err2 := getAsync(m, ctx2, "x")
+
+	// The deadline of the second caller passes first.
+	if err := <-err2; err != context.DeadlineExceeded {
+		t.Errorf("GetContext returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	waitFor(t, m, func(s memo.Stats) bool { return s.Abandoned == 1 })
+	if err := callCtx.Err(); err != nil {
+		t.Errorf("call was cancelled (%v) while a caller still waited", err)
+	}
+
+	cancel1()
+	if err := <-err1; err != context.Canceled {
+		t.Errorf("GetContext returned %v, want %v", err, context.Canceled)
+	}
+	select {
+	case <-callCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("call was not cancelled after all callers gave up")
+	}
+	waitFor(t, m, func(s memo.Stats) bool { return s.Cancels == 1 })
+
+	// The cancelled call is not cached: the next request calls f again.
+	close(b.release)
+	if v, err := m.Get("x"); v != "x" || err != nil {
+		t.Errorf(`Get("x") = %v, %v; want x, nil`, v, err)
+	}
+	if n := len(b.started); n != 1 {
+		t.Errorf("after cancellation, %d more calls, want 1", n)
+	}
+}
+
+func TestGetContextDone(t *testing.T) {
+	b := newBlocker()
+	close(b.release)
+	m := memo.NewContext(b.f)
+	defer m.Close()
+
+	// A ready result is delivered even if the context is done.
+	if _, err := m.Get("x"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if v, err := m.GetContext(ctx, "x"); v != "x" || err != nil {
+		t.Errorf(`GetContext("x") = %v, %v; want x, nil`, v, err)
+	}
+}
+
+func TestCapacityInFlight(t *testing.T) {
+	b := newBlocker()
+	m := memo.Options{Capacity: 1}.NewContext(b.f)
+	defer m.Close()
+
+	// The call for b does not evict the call for a, which is in
+	// progress, so the second request for a waits for it.
+	a1 := getAsync(m, context.Background(), "a")
+	<-b.started
+	bb := getAsync(m, context.Background(), "b")
+	<-b.started
+	a2 := getAsync(m, context.Background(), "a")
+	waitFor(t, m, func(s memo.Stats) bool { return s.Dedups == 1 })
+	close(b.release)
+	for _, ch := range []<-chan error{a1, bb, a2} {
+		if err := <-ch; err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := memo.Stats{Misses: 2, Dedups: 1, Entries: 2}
+	if got := m.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	// The next miss restores the capacity.
+	m.Get("c")
+	want = memo.Stats{Misses: 3, Dedups: 1, Evictions: 2, Entries: 1}
+	if got := m.Stats(); got != want {
+		t.Errorf("after Get(c), Stats() = %+v, want %+v", got, want)
+	}
+	if n := len(b.started); n != 1 {
+		t.Errorf("%d more calls, want 1", n)
+	}
+}
@@ -7,13 +7,31 @@
 // of a function.  Requests for different keys proceed in parallel.
 // Concurrent requests for the same key block until the first completes.
 // This implementation uses a monitor goroutine.
+//
+// A Memo created by Options.New may bound the size of its cache,
+// evicting the least recently used entries, and may expire entries
+// some time after their results are ready.
+//
+// GetContext lets a caller give up waiting for a result.  The call
+// of the function continues while any caller still waits for it;
+// a function created by NewContext is cancelled when none do.
 package memo
 
+import (
+	"container/list"
+	"context"
+	"time"
+)
+
 //!+Func
 
 // Func is the type of the function to memoize.
 type Func func(key string) (interface{}, error)
 
+// FuncContext is the type of a function to memoize that
+// gives up when its context is cancelled.
+type FuncContext func(ctx context.Context, key string) (interface{}, error)
+
 // A result is the result of calling a Func.
 type result struct {
 	value interface{}
@@ -21,8 +39,14 @@ type result struct {
 }
 
 type entry struct {
-	res   result
-	ready chan struct{} // closed when res is ready
+	res     result
+	ready   chan struct{} // closed when res is ready
+	expires time.Time     // when res expires, or zero for never; set before ready is closed
+
+	key     string
+	elem    *list.Element      // in the server's LRU list
+	waiters int                // number of requests, less those that gave up
+	cancel  context.CancelFunc // cancels the call of the Func
 }
 
 //!-Func
@@ -31,22 +55,33 @@ type entry struct {
 
 // A request is a message requesting that the Func be applied to key.
 type request struct {
+	ctx      context.Context
 	key      string
 	response chan<- result // the client wants a single result
 }
 
-type Memo struct{ requests chan request }
+type Memo struct {
+	requests chan request
+	stats    chan chan Stats // requests for statistics
+	leave    chan *entry     // a client gave up waiting for the entry
+	done     chan struct{}   // closed when the server exits
+}
 
 // New returns a memoization of f.  Clients must subsequently call Close.
-func New(f Func) *Memo {
-	memo := &Memo{requests: make(chan request)}
-	go memo.server(f)
-	return memo
-}
+func New(f Func) *Memo { return Options{}.New(f) }
+
+// NewContext returns a memoization of f.  Clients must subsequently call Close.
+func NewContext(f FuncContext) *Memo { return Options{}.NewContext(f) }
 
 func (memo *Memo) Get(key string) (interface{}, error) {
+	return memo.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but returns ctx.Err() if ctx is cancelled
+// before the result is ready.
+func (memo *Memo) GetContext(ctx context.Context, key string) (interface{}, error) {
 	response := make(chan result)
-	memo.requests <- request{key, response}
+	memo.requests <- request{ctx, key, response}
 	res := <-response
 	return res.value, res.err
 }
@@ -55,32 +90,194 @@ func (memo *Memo) Close() { close(memo.requests) }
 
 //!-get
 
+// Options limit the contents of a Memo's cache.
+// The zero value imposes no limits.
+type Options struct {
+	// Capacity is the maximum number of entries in the cache.
+	// When it is exceeded, the least recently used entries whose
+	// results are ready are evicted; entries whose calls are in
+	// progress may exceed it.  Zero means no limit.
+	Capacity int
+
+	// TTL is how long an entry remains in the cache once its
+	// result is ready.  Zero means forever.
+	TTL time.Duration
+
+	// ErrorTTL, if non-zero, replaces TTL for results that are
+	// errors.  If negative, errors are not cached, though
+	// concurrent requests for the same key still share them.
+	ErrorTTL time.Duration
+}
+
+// New returns a memoization of f with the limits of o.
+// Clients must subsequently call Close.
+func (o Options) New(f Func) *Memo {
+	return o.NewContext(func(_ context.Context, key string) (interface{}, error) {
+		return f(key)
+	})
+}
+
+// NewContext returns a memoization of f with the limits of o.
+// Clients must subsequently call Close.
+func (o Options) NewContext(f FuncContext) *Memo {
+	return newMemo(f, o, time.Now)
+}
+
+func newMemo(f FuncContext, o Options, now func() time.Time) *Memo {
+	memo := &Memo{
+		requests: make(chan request),
+		stats:    make(chan chan Stats),
+		leave:    make(chan *entry),
+		done:     make(chan struct{}),
+	}
+	go memo.server(f, o, now)
+	return memo
+}
+
+// Stats are counts of the requests made of a Memo.
+type Stats struct {
+	Hits        int // requests for ready results
+	Misses      int // requests that called the Func
+	Dedups      int // requests that waited for another's call
+	Abandoned   int // requests that gave up waiting
+	Cancels     int // calls cancelled because all their requests gave up
+	Evictions   int // entries removed to respect the capacity
+	Expirations int // entries removed because their TTL elapsed
+	Entries     int // current number of entries
+}
+
+// Stats returns the statistics of the Memo.
+// It must not be called after Close.
+func (memo *Memo) Stats() Stats {
+	reply := make(chan Stats)
+	memo.stats <- reply
+	return <-reply
+}
+
 //!+monitor
 
-func (memo *Memo) server(f Func) {
+func (memo *Memo) server(f FuncContext, o Options, now func() time.Time) {
+	defer close(memo.done)
 	cache := make(map[string]*entry)
-	for req := range memo.requests {
-		e := cache[req.key]
-		if e == nil {
-			// This is the first request for this key.
-			e = &entry{ready: make(chan struct{})}
-			cache[req.key] = e
-			go e.call(f, req.key) // call f(key)
+	lru := list.New() // of *entry, most recently used at front
+	var stats Stats
+	remove := func(e *entry) {
+		delete(cache, e.key)
+		lru.Remove(e.elem)
+	}
+	for {
+		select {
+		case req, ok := <-memo.requests:
+			if !ok {
+				return // closed
+			}
+			e := cache[req.key]
+			if e != nil && e.expired(now()) {
+				remove(e)
+				stats.Expirations++
+				e = nil
+			}
+			if e == nil {
+				// This is the first request for this key.
+				stats.Misses++
+				ctx, cancel := context.WithCancel(context.Background())
+				e = &entry{ready: make(chan struct{}), key: req.key, cancel: cancel}
+				cache[req.key] = e
+				e.elem = lru.PushFront(e)
+				go e.call(ctx, f, req.key, o, now) // call f(ctx, key)
+
+				// Remove expired entries from the back of the list,
+				// then evict the least recently used if need be.
+				for back := lru.Back(); back != nil && back.Value.(*entry).expired(now()); back = lru.Back() {
+					remove(back.Value.(*entry))
+					stats.Expirations++
+				}
+				// Entries whose calls are in progress are not evicted,
+				// lest another request for the key call f again.
+				for elem := lru.Back(); elem != nil && o.Capacity > 0 && lru.Len() > o.Capacity; {
+					prev := elem.Prev()
+					if e := elem.Value.(*entry); e.isReady() {
+						remove(e)
+						stats.Evictions++
+					}
+					elem = prev
+				}
+			} else {
+				if e.isReady() {
+					stats.Hits++
+				} else {
+					stats.Dedups++
+				}
+				lru.MoveToFront(e.elem)
+			}
+			e.waiters++
+			go e.deliver(memo, req.ctx, req.response)
+
+		case e := <-memo.leave:
+			stats.Abandoned++
+			e.waiters--
+			if e.waiters == 0 && !e.isReady() {
+				// No one wants the result: cancel the call,
+				// and let the next request for the key retry.
+				e.cancel()
+				stats.Cancels++
+				if cache[e.key] == e {
+					remove(e)
+				}
+			}
+
+		case reply := <-memo.stats:
+			stats.Entries = len(cache)
+			reply <- stats
 		}
-		go e.deliver(req.response)
 	}
 }
 
-func (e *entry) call(f Func, key string) {
+func (e *entry) call(ctx context.Context, f FuncContext, key string, o Options, now func() time.Time) {
 	// Evaluate the function.
-	e.res.value, e.res.err = f(key)
+	e.res.value, e.res.err = f(ctx, key)
+	e.cancel() // release the context's resources
+	ttl := o.TTL
+	if e.res.err != nil && o.ErrorTTL != 0 {
+		ttl = o.ErrorTTL
+	}
+	if ttl != 0 {
+		e.expires = now().Add(ttl)
+	}
 	// Broadcast the ready condition.
 	close(e.ready)
 }
 
-func (e *entry) deliver(response chan<- result) {
-	// Wait for the ready condition.
-	<-e.ready
+// isReady reports whether the result of e is ready.
+func (e *entry) isReady() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// expired reports whether the result of e is ready and has expired at time t.
+func (e *entry) expired(t time.Time) bool {
+	return e.isReady() && !e.expires.IsZero() && !t.Before(e.expires)
+}
+
+func (e *entry) deliver(memo *Memo, ctx context.Context, response chan<- result) {
+	// Wait for the ready condition, or for the client to give up.
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		if e.isReady() {
+			break // a ready result is delivered regardless
+		}
+		select {
+		case memo.leave <- e:
+		case <-memo.done:
+		}
+		response <- result{nil, ctx.Err()}
+		return
+	}
 	// Send the result to the client.
 	response <- e.res
 }
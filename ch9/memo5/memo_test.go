@@ -4,7 +4,9 @@
 package memo_test
 
 import (
+	"sync"
 	"testing"
+	"time"
 
 	"gopl.io/ch9/memo5"
 	"gopl.io/ch9/memotest"
@@ -23,3 +25,28 @@ func TestConcurrent(t *testing.T) {
 	defer m.Close()
 	memotest.Concurrent(t, m)
 }
+
+// TestConcurrentLimited checks that a Memo with limits still calls
+// the function only once for concurrent requests for the same key.
+func TestConcurrentLimited(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	slowGetBody := func(url string) (interface{}, error) {
+		mu.Lock()
+		calls[url]++
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return []byte(url), nil
+	}
+	m := memo.Options{Capacity: 100, TTL: time.Hour, ErrorTTL: -1}.New(slowGetBody)
+	defer m.Close()
+	memotest.Concurrent(t, m)
+	for url, n := range calls {
+		if n != 1 {
+			t.Errorf("%d calls for %s, want 1", n, url)
+		}
+	}
+	if stats := m.Stats(); stats.Misses != len(calls) || stats.Misses+stats.Hits+stats.Dedups != 8 {
+		t.Errorf("Stats() = %+v, want %d misses of 8 requests", stats, len(calls))
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Package memo provides a concurrency-safe memoization of a function
+// from keys of type K to results of type V.  Requests for different
+// keys proceed in parallel.  Concurrent requests for the same key
+// block until the first completes.
+//
+// There are two implementations of the Memo interface: NewMutex
+// returns one that uses a Mutex, like gopl.io/ch9/memo4, and
+// NewMonitor returns one that uses a monitor goroutine, like
+// gopl.io/ch9/memo5.
+package memo
+
+// Func is the type of the function to memoize.
+type Func[K comparable, V any] func(key K) (V, error)
+
+// A Memo is a memoization of a Func.
+type Memo[K comparable, V any] interface {
+	// Get returns the result of calling the Func with key,
+	// calling it only if no other request for key has done so.
+	Get(key K) (V, error)
+
+	// Close releases the resources of the Memo.
+	// Clients must not call Get after Close.
+	Close()
+}
+
+// A result is the result of calling a Func.
+type result[V any] struct {
+	value V
+	err   error
+}
+
+type entry[V any] struct {
+	res   result[V]
+	ready chan struct{} // closed when res is ready
+}
@@ -0,0 +1,115 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package memo_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopl.io/ch9/memo6"
+	"gopl.io/ch9/memotest"
+)
+
+var implementations = []string{"Mutex", "Monitor"}
+
+// newMemo returns a memoization of f by the named implementation.
+func newMemo[K comparable, V any](impl string, f memo.Func[K, V]) memo.Memo[K, V] {
+	if impl == "Mutex" {
+		return memo.NewMutex(f)
+	}
+	return memo.NewMonitor(f)
+}
+
+func Test(t *testing.T) {
+	for _, impl := range implementations {
+		m := newMemo(impl, memotest.HTTPGetBytes)
+		memotest.Sequential(t, m)
+		m.Close()
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	for _, impl := range implementations {
+		m := newMemo(impl, memotest.HTTPGetBytes)
+		memotest.Concurrent(t, m)
+		m.Close()
+	}
+}
+
+// TestOnce checks that each implementation calls the function once
+// per key, however many concurrent requests there are.
+func TestOnce(t *testing.T) {
+	for _, impl := range implementations {
+		var mu sync.Mutex
+		calls := make(map[int]int)
+		square := func(x int) (int, error) {
+			mu.Lock()
+			calls[x]++
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			if x < 0 {
+				return 0, fmt.Errorf("negative: %d", x)
+			}
+			return x * x, nil
+		}
+		m := newMemo(impl, square)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func(x int) {
+				defer wg.Done()
+				y, err := m.Get(x)
+				if x < 0 && (err == nil || err.Error() != fmt.Sprintf("negative: %d", x)) {
+					t.Errorf("%s: Get(%d) returned error %v", impl, x, err)
+				} else if x >= 0 && (y != x*x || err != nil) {
+					t.Errorf("%s: Get(%d) = %d, %v; want %d", impl, x, y, err, x*x)
+				}
+			}(i%10 - 5)
+		}
+		wg.Wait()
+		m.Close()
+		for x, n := range calls {
+			if n != 1 {
+				t.Errorf("%s: %d calls of f(%d), want 1", impl, n, x)
+			}
+		}
+	}
+}
+
+func identity[T any](x T) (T, error) { return x, nil }
+
+// BenchmarkHit measures concurrent requests for a few ready results.
+func BenchmarkHit(b *testing.B) {
+	for _, impl := range implementations {
+		b.Run(impl, func(b *testing.B) {
+			m := newMemo(impl, identity[int])
+			defer m.Close()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					m.Get(i % 16)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMiss measures concurrent requests for distinct keys.
+func BenchmarkMiss(b *testing.B) {
+	for _, impl := range implementations {
+		b.Run(impl, func(b *testing.B) {
+			m := newMemo(impl, identity[int64])
+			defer m.Close()
+			var key int64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					m.Get(atomic.AddInt64(&key, 1))
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package memo
+
+// A request is a message requesting that the Func be applied to key.
+type request[K comparable, V any] struct {
+	key      K
+	response chan<- result[V] // the client wants a single result
+}
+
+// NewMonitor returns a memoization of f that uses a monitor goroutine.
+// Clients must subsequently call Close.
+func NewMonitor[K comparable, V any](f Func[K, V]) Memo[K, V] {
+	memo := &monitorMemo[K, V]{requests: make(chan request[K, V])}
+	go memo.server(f)
+	return memo
+}
+
+type monitorMemo[K comparable, V any] struct{ requests chan request[K, V] }
+
+func (memo *monitorMemo[K, V]) Get(key K) (V, error) {
+	response := make(chan result[V])
+	memo.requests <- request[K, V]{key, response}
+	res := <-response
+	return res.value, res.err
+}
+
+func (memo *monitorMemo[K, V]) Close() { close(memo.requests) }
+
+func (memo *monitorMemo[K, V]) server(f Func[K, V]) {
+	cache := make(map[K]*entry[V])
+	for req := range memo.requests {
+		e := cache[req.key]
+		if e == nil {
+			// This is the first request for this key.
+			e = &entry[V]{ready: make(chan struct{})}
+			cache[req.key] = e
+			go call(e, f, req.key) // call f(key)
+		}
+		go e.deliver(req.response)
+	}
+}
+
+// call is a function, not a method of entry, because it needs the
+// key type as well as the result type.
+func call[K comparable, V any](e *entry[V], f Func[K, V], key K) {
+	// Evaluate the function.
+	e.res.value, e.res.err = f(key)
+	// Broadcast the ready condition.
+	close(e.ready)
+}
+
+func (e *entry[V]) deliver(response chan<- result[V]) {
+	// Wait for the ready condition.
+	<-e.ready
+	// Send the result to the client.
+	response <- e.res
+}
@@ -0,0 +1,42 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package memo
+
+import "sync"
+
+// NewMutex returns a memoization of f that uses a Mutex.
+func NewMutex[K comparable, V any](f Func[K, V]) Memo[K, V] {
+	return &mutexMemo[K, V]{f: f, cache: make(map[K]*entry[V])}
+}
+
+type mutexMemo[K comparable, V any] struct {
+	f     Func[K, V]
+	mu    sync.Mutex // guards cache
+	cache map[K]*entry[V]
+}
+
+func (memo *mutexMemo[K, V]) Get(key K) (V, error) {
+	memo.mu.Lock()
+	e := memo.cache[key]
+	if e == nil {
+		// This is the first request for this key.
+		// This goroutine becomes responsible for computing
+		// the value and broadcasting the ready condition.
+		e = &entry[V]{ready: make(chan struct{})}
+		memo.cache[key] = e
+		memo.mu.Unlock()
+
+		e.res.value, e.res.err = memo.f(key)
+
+		close(e.ready) // broadcast ready condition
+	} else {
+		// This is a repeat request for this key.
+		memo.mu.Unlock()
+
+		<-e.ready // wait for ready condition
+	}
+	return e.res.value, e.res.err
+}
+
+func (memo *mutexMemo[K, V]) Close() {}
@@ -31,6 +31,14 @@ func httpGetBody(url string) (interface{}, error) {
 
 var HTTPGetBody = httpGetBody
 
+// HTTPGetBytes is like HTTPGetBody, but its result has type []byte,
+// for use with memoizers of a specific result type.
+func HTTPGetBytes(url string) ([]byte, error) {
+	body, err := httpGetBody(url)
+	b, _ := body.([]byte)
+	return b, err
+}
+
 func incomingURLs() <-chan string {
 	ch := make(chan string)
 	go func() {
@@ -51,8 +59,16 @@ func incomingURLs() <-chan string {
 	return ch
 }
 
-type M interface {
-	Get(key string) (interface{}, error)
+// M is a memoization whose results are of type V, which is []byte
+// or an interface holding one.
+type M[V any] interface {
+	Get(key string) (V, error)
+}
+
+// size returns the number of bytes in the result of a Get.
+func size(value interface{}) int {
+	b, _ := value.([]byte)
+	return len(b)
 }
 
 /*
@@ -61,7 +77,7 @@ type M interface {
 //!-seq
 */
 
-func Sequential(t *testing.T, m M) {
+func Sequential[V any](t *testing.T, m M[V]) {
 	//!+seq
 	for url := range incomingURLs() {
 		start := time.Now()
@@ -71,7 +87,7 @@ func Sequential(t *testing.T, m M) {
 			continue
 		}
 		fmt.Printf("%s, %s, %d bytes\n",
-			url, time.Since(start), len(value.([]byte)))
+			url, time.Since(start), size(value))
 	}
 	//!-seq
 }
@@ -82,7 +98,7 @@ func Sequential(t *testing.T, m M) {
 //!-conc
 */
 
-func Concurrent(t *testing.T, m M) {
+func Concurrent[V any](t *testing.T, m M[V]) {
 	//!+conc
 	var n sync.WaitGroup
 	for url := range incomingURLs() {
@@ -96,7 +112,7 @@ func Concurrent(t *testing.T, m M) {
 				return
 			}
 			fmt.Printf("%s, %s, %d bytes\n",
-				url, time.Since(start), len(value.([]byte)))
+				url, time.Since(start), size(value))
 		}(url)
 	}
 	n.Wait()